@@ -0,0 +1,346 @@
+package main
+
+import (
+	"0ms2/sim"
+	"encoding/json"
+	"fmt"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/ungerik/go3d/float64/vec2"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"time"
+)
+
+// achievementsPath defines the achievements, achievementsFile saves the
+// progress towards them
+const achievementsPath = "achievements.json"
+const achievementsFile = "achievement-progress.json"
+
+// An unlock toast stays up for toastTime ms, fading in and out
+const toastTime = 3500
+const toastFade = 400
+
+var toastColor = color.NRGBA{0x22, 0x20, 0x34, 0xe0}
+var toastTitleColor = color.RGBA{0xfb, 0xf2, 0x36, 0xFF}
+
+// statKind is how a stat gathers its values over a run, and over every run
+// for the achievements counting them all.
+type statKind int
+
+const (
+	statSum statKind = iota
+	statMax
+	statMin
+)
+
+// achievementStats are the stats achievements can be about. Times are in
+// seconds and altitudes in km.
+var achievementStats = map[string]statKind{
+	"altitude":       statMax,
+	"flight_time":    statSum,
+	"coasting":       statMax,
+	"min_fuel":       statMin,
+	"o2_collected":   statSum,
+	"fuel_collected": statSum,
+	"powerups":       statSum,
+}
+
+// AchievementDef is an achievement of achievementsPath. It unlocks when Stat
+// reaches Goal in a run, or over every run when Total is set. AtRunEnd ones
+// are only checked when a run ends, for stats that can still fail until
+// then. Requires are other stats the run must reach too. The name and
+// description are the messages "achievement.<id>" and
+// "achievement.<id>.description".
+type AchievementDef struct {
+	ID       string             `json:"id"`
+	Stat     string             `json:"stat"`
+	Goal     float64            `json:"goal"`
+	Total    bool               `json:"total"`
+	AtRunEnd bool               `json:"atRunEnd"`
+	Requires map[string]float64 `json:"requires"`
+}
+
+// LoadAchievementDefs reads the achievements, rejecting unknown stats.
+func LoadAchievementDefs(path string) ([]*AchievementDef, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var defs []*AchievementDef
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, err
+	}
+
+	for _, def := range defs {
+		stats := []string{def.Stat}
+		for stat := range def.Requires {
+			stats = append(stats, stat)
+		}
+		for _, stat := range stats {
+			if _, ok := achievementStats[stat]; !ok {
+				return nil, fmt.Errorf("%s: unknown stat %q", def.ID, stat)
+			}
+		}
+	}
+
+	return defs, nil
+}
+
+// AchievementProgress is what is saved: when each achievement was unlocked,
+// the stats of every run together and the best run of each stat.
+type AchievementProgress struct {
+	Unlocked map[string]time.Time `json:"unlocked"`
+	Totals   map[string]float64   `json:"totals"`
+	Best     map[string]float64   `json:"best"`
+}
+
+type toast struct {
+	id    string
+	shown time.Time
+}
+
+// Achievements keeps the stats of the current run from the J0hns and the
+// events, unlocks achievements as they are met and shows a toast for each.
+// In co-op the players share the run: the highest of them sets the altitude
+// and the one with the least fuel the min fuel.
+type Achievements struct {
+	Defs     []*AchievementDef
+	Progress AchievementProgress
+
+	players  []*sim.J0hn
+	run      map[string]float64
+	coasting float64
+	toasts   []*toast
+}
+
+func NewAchievements() *Achievements {
+	a := &Achievements{
+		Progress: AchievementProgress{
+			Unlocked: make(map[string]time.Time),
+			Totals:   make(map[string]float64),
+			Best:     make(map[string]float64),
+		},
+	}
+
+	defs, err := LoadAchievementDefs(achievementsPath)
+	if err != nil {
+		progressLog.WithField("file", achievementsPath).Errorln("can't load achievements:", err)
+	}
+	a.Defs = defs
+
+	if err := loadConfig(achievementsFile, &a.Progress); err != nil {
+		progressLog.WithField("file", achievementsFile).Warnln("can't load achievement progress:", err)
+	}
+	if a.Progress.Unlocked == nil {
+		a.Progress.Unlocked = make(map[string]time.Time)
+	}
+	if a.Progress.Totals == nil {
+		a.Progress.Totals = make(map[string]float64)
+	}
+	if a.Progress.Best == nil {
+		a.Progress.Best = make(map[string]float64)
+	}
+
+	events.Subscribe(a.handle)
+	return a
+}
+
+// Watch starts keeping the stats of a new run.
+func (a *Achievements) Watch(players []*sim.J0hn) {
+	a.players = players
+	a.run = map[string]float64{"min_fuel": 100}
+	for _, p := range players {
+		a.run["min_fuel"] = math.Min(a.run["min_fuel"], p.Fuel)
+	}
+	a.coasting = 0
+}
+
+func (a *Achievements) handle(e sim.Event) {
+	switch e.Kind {
+	case sim.EventThrust:
+		a.coasting = 0
+	case sim.EventPickup:
+		a.run["powerups"]++
+		if e.Powerup == sim.O2Type {
+			a.run["o2_collected"]++
+		} else {
+			a.run["fuel_collected"]++
+		}
+	case sim.EventRunEnd:
+		a.check(true)
+		for stat, value := range a.run {
+			a.Progress.Totals[stat] = a.Total(stat)
+			a.Progress.Best[stat] = math.Max(a.Progress.Best[stat], value)
+		}
+		a.save()
+		// the run is in the totals now
+		a.Watch(a.players)
+	}
+	a.check(false)
+}
+
+// Total is stat over every run, the current one included.
+func (a *Achievements) Total(stat string) float64 {
+	total, seen := a.Progress.Totals[stat]
+	value := a.run[stat]
+
+	switch achievementStats[stat] {
+	case statMax:
+		return math.Max(total, value)
+	case statMin:
+		if !seen {
+			return value
+		}
+		return math.Min(total, value)
+	}
+	return total + value
+}
+
+// Update gathers the stats the J0hns show every tick, delta is in ms.
+func (a *Achievements) Update(delta int64) {
+	flying, thrusting := false, false
+	for _, p := range a.players {
+		if !p.Flying {
+			continue
+		}
+
+		flying = true
+		thrusting = thrusting || p.IsAccelerating || p.IsLifting
+		a.run["altitude"] = math.Max(a.run["altitude"], p.RelativePosition[1])
+		a.run["min_fuel"] = math.Min(a.run["min_fuel"], p.Fuel)
+	}
+	if !flying {
+		return
+	}
+
+	seconds := float64(delta) / 1000
+	a.run["flight_time"] += seconds
+	if !thrusting {
+		a.coasting += seconds
+		a.run["coasting"] = math.Max(a.run["coasting"], a.coasting)
+	}
+
+	a.check(false)
+}
+
+// Value is where def stands, in the current run or over every run.
+func (a *Achievements) Value(def *AchievementDef) float64 {
+	if def.Total {
+		return a.Total(def.Stat)
+	}
+	return a.run[def.Stat]
+}
+
+// Percent is how close def is to unlocking, from 0 to 1. Run achievements
+// count the best run, run end ones are either met or not.
+func (a *Achievements) Percent(def *AchievementDef) float64 {
+	if _, ok := a.Progress.Unlocked[def.ID]; ok {
+		return 1
+	}
+	if def.AtRunEnd {
+		return 0
+	}
+
+	value := a.Value(def)
+	if !def.Total {
+		value = math.Max(value, a.Progress.Best[def.Stat])
+	}
+
+	return clamp01(value / def.Goal)
+}
+
+func (a *Achievements) met(def *AchievementDef) bool {
+	if a.Value(def) < def.Goal {
+		return false
+	}
+
+	for stat, goal := range def.Requires {
+		if a.run[stat] < goal {
+			return false
+		}
+	}
+
+	return true
+}
+
+// check unlocks the achievements met, the run end ones only when it ends.
+func (a *Achievements) check(runEnd bool) {
+	if a.run == nil {
+		return
+	}
+
+	for _, def := range a.Defs {
+		if _, ok := a.Progress.Unlocked[def.ID]; ok || def.AtRunEnd != runEnd {
+			continue
+		}
+
+		if a.met(def) {
+			a.Unlock(def.ID)
+		}
+	}
+}
+
+// Unlock records an achievement and queues its toast.
+func (a *Achievements) Unlock(id string) {
+	if _, ok := a.Progress.Unlocked[id]; ok {
+		return
+	}
+
+	a.Progress.Unlocked[id] = time.Now()
+	a.toasts = append(a.toasts, &toast{id: id})
+	progressLog.WithField("achievement", id).Infoln("achievement unlocked")
+	a.save()
+}
+
+func (a *Achievements) save() {
+	if err := saveConfig(achievementsFile, a.Progress); err != nil {
+		progressLog.WithField("file", achievementsFile).Errorln("can't save achievement progress:", err)
+	}
+}
+
+// DrawToasts shows the oldest unlock not shown yet at the top of the screen.
+func (a *Achievements) DrawToasts(screen *ebiten.Image, layout *HUDLayout) {
+	if len(a.toasts) == 0 {
+		return
+	}
+
+	t := a.toasts[0]
+	if t.shown.IsZero() {
+		t.shown = time.Now()
+	}
+	elapsed := float64(time.Since(t.shown)) / float64(time.Millisecond)
+	if elapsed > toastTime {
+		a.toasts = a.toasts[1:]
+		return
+	}
+	alpha := clamp01(math.Min(elapsed, toastTime-elapsed) / toastFade)
+
+	scale := layout.Scale() * settings.TextScale
+	titleFace := fonts.Face(uiFont, 14*scale)
+	nameFace := fonts.Face(uiFont, 20*scale)
+	title, name := T("achievements.toast"), T("achievement."+t.id)
+	width := math.Max(float64(MeasureText(titleFace, title).Width), float64(MeasureText(nameFace, name).Width)) + 32*scale
+	height := 64 * scale
+
+	pos := layout.Place(AnchorTopCenter, vec2.T{0, 20}, vec2.T{width, height})
+	c := toastColor
+	c.A = uint8(float64(c.A) * alpha)
+	ebitenutil.DrawRect(screen, pos[0], pos[1], width, height, c)
+
+	middle := int(pos[0] + width/2)
+	DrawText(screen, title, titleFace, middle, int(pos[1]+22*scale), TextStyle{
+		Color: fadeColor(toastTitleColor, alpha),
+		Align: AlignCenter,
+	})
+	DrawText(screen, name, nameFace, middle, int(pos[1]+50*scale), TextStyle{
+		Color: fadeColor(menuTextColor, alpha),
+		Align: AlignCenter,
+	})
+}
+
+func fadeColor(c color.RGBA, alpha float64) color.NRGBA {
+	return color.NRGBA{c.R, c.G, c.B, uint8(float64(c.A) * alpha)}
+}
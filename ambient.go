@@ -0,0 +1,182 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/ungerik/go3d/float64/vec2"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// ambientFade is how long, in ms, ambient particles take to fade in and out.
+const ambientFade = 500.0
+
+type ambientParticle struct {
+	effect   sim.AmbientEffect
+	position vec2.T
+	velocity vec2.T
+	size     vec2.T
+	color    color.NRGBA
+	life     float64
+	maxLife  float64
+}
+
+// ambientSpawnRate is the chance per tick of spawning a particle of an effect.
+var ambientSpawnRate = map[sim.AmbientEffect]float64{
+	sim.AmbientClouds:    .02,
+	sim.AmbientHaze:      .015,
+	sim.AmbientMeteors:   .02,
+	sim.AmbientAurora:    .04,
+	sim.AmbientSolarWind: .25,
+}
+
+// Ambient decorates the sky with the effects of the current atmosphere zone,
+// near a zone boundary both zones spawn, weighted by the blend between them.
+type Ambient struct {
+	camera          *sim.Camera
+	particles       []*ambientParticle
+	timeAccumulator float64
+	clock           float64
+}
+
+func NewAmbient(camera *sim.Camera) *Ambient {
+	return &Ambient{
+		camera: camera,
+	}
+}
+
+// newAmbientParticle makes a particle of effect, clouds and haze enter from the
+// top while the sky scrolls and appear anywhere on the upper half otherwise.
+func newAmbientParticle(effect sim.AmbientEffect, scrolling bool) *ambientParticle {
+	p := &ambientParticle{effect: effect}
+	entry := func(height float64) float64 {
+		if scrolling {
+			return -height
+		}
+		return rand.Float64() * windowHeight / 2
+	}
+
+	switch effect {
+	case sim.AmbientClouds:
+		p.size = vec2.T{60 + rand.Float64()*120, 18 + rand.Float64()*30}
+		p.position = vec2.T{rand.Float64()*(windowWidth+p.size[0]) - p.size[0], entry(p.size[1])}
+		p.velocity = vec2.T{(rand.Float64() - .5) * .6, 0}
+		p.color = color.NRGBA{0xff, 0xff, 0xff, 0x60}
+		p.maxLife = 20000
+	case sim.AmbientHaze:
+		p.size = vec2.T{windowWidth, 3 + rand.Float64()*9}
+		p.position = vec2.T{0, entry(p.size[1])}
+		p.color = color.NRGBA{0xcb, 0xdb, 0xfc, 0x28}
+		p.maxLife = 20000
+	case sim.AmbientMeteors:
+		p.position = vec2.T{rand.Float64() * windowWidth, rand.Float64() * windowHeight / 2}
+		p.velocity = vec2.T{(2 + rand.Float64()*3) * float64(1-2*rand.Intn(2)), 6 + rand.Float64()*4}
+		p.color = color.NRGBA{0xfb, 0xf2, 0x36, 0xff}
+		p.maxLife = 600 + rand.Float64()*600
+	case sim.AmbientAurora:
+		p.size = vec2.T{15 + rand.Float64()*30, 120 + rand.Float64()*200}
+		p.position = vec2.T{rand.Float64() * windowWidth, rand.Float64()*windowHeight/2 - p.size[1]/2}
+		p.velocity = vec2.T{(rand.Float64() - .5) * .4, 0}
+		p.color = color.NRGBA{0x6a, 0xbe, 0x30, 0x40}
+		if rand.Float64() < .3 {
+			p.color = color.NRGBA{0x76, 0x42, 0x8a, 0x40}
+		}
+		p.maxLife = 3000 + rand.Float64()*3000
+	case sim.AmbientSolarWind:
+		p.size = vec2.T{j0hnScale, j0hnScale}
+		p.position = vec2.T{-p.size[0], rand.Float64() * windowHeight}
+		p.velocity = vec2.T{8 + rand.Float64()*6, (rand.Float64() - .5) * 2}
+		p.color = color.NRGBA{0xee, 0xc3, 0x9a, 0x70}
+		p.maxLife = 2500
+	}
+
+	p.life = p.maxLife
+	return p
+}
+
+func (a *Ambient) spawn(effect sim.AmbientEffect, weight float64) {
+	if effect == sim.AmbientNone || rand.Float64() >= ambientSpawnRate[effect]*weight {
+		return
+	}
+	if settings.ReduceMotion && (effect == sim.AmbientMeteors || effect == sim.AmbientSolarWind) {
+		return
+	}
+
+	a.particles = append(a.particles, newAmbientParticle(effect, a.camera.Velocity[1] > 0))
+}
+
+func (a *Ambient) Update(_ *ebiten.Image, delta int64) {
+	a.timeAccumulator += float64(delta)
+
+	for a.timeAccumulator >= sim.Tick {
+		a.timeAccumulator -= sim.Tick
+		a.clock += sim.Tick / 1000
+
+		zone, next, blend := sim.AtmosphereAt(a.camera.RelativePosition[1])
+		a.spawn(zone.Ambient, 1-blend)
+		if next != nil {
+			a.spawn(next.Ambient, blend)
+		}
+
+		// ambient stuff is as far as the sky, it scrolls with the background
+		scroll := copyVector(*a.camera.Velocity)
+		scroll.Scale(float64(sim.Tick) / 300)
+
+		alive := a.particles[:0]
+		for _, p := range a.particles {
+			p.position.Add(&p.velocity).Add(&scroll)
+			p.life -= sim.Tick
+
+			if p.life > 0 &&
+				p.position[1] < windowHeight &&
+				p.position[0] < windowWidth+p.size[0] &&
+				p.position[0] > -windowWidth {
+				alive = append(alive, p)
+			}
+		}
+		a.particles = alive
+	}
+}
+
+// fade eases particles in and out over ambientFade ms.
+func (p *ambientParticle) fade() float64 {
+	return math.Min(1, math.Min(p.life, p.maxLife-p.life)/ambientFade)
+}
+
+func (p *ambientParticle) faded(alpha float64) color.NRGBA {
+	c := p.color
+	c.A = uint8(float64(c.A) * alpha)
+	return c
+}
+
+// snap keeps ambient shapes on the sprites pixel grid.
+func snap(v float64) float64 {
+	return math.Floor(v/j0hnScale) * j0hnScale
+}
+
+func (a *Ambient) Draw(screen *ebiten.Image) {
+	for _, p := range a.particles {
+		x, y := snap(p.position[0]), snap(p.position[1])
+
+		switch p.effect {
+		case sim.AmbientClouds:
+			c := p.faded(p.fade())
+			w, h := snap(p.size[0]), snap(p.size[1])
+			ebitenutil.DrawRect(screen, x, y+h/3, w, h-h/3, c)
+			ebitenutil.DrawRect(screen, x+snap(w/4), y, snap(w/2), h/3, c)
+		case sim.AmbientHaze:
+			ebitenutil.DrawRect(screen, x, y, p.size[0], snap(p.size[1]), p.faded(p.fade()))
+		case sim.AmbientMeteors:
+			tail := copyVector(p.velocity)
+			tail.Scale(-4)
+			ebitenutil.DrawLine(screen, p.position[0], p.position[1], p.position[0]+tail[0], p.position[1]+tail[1], p.faded(p.fade()))
+		case sim.AmbientAurora:
+			wave := .6 + .4*math.Sin(a.clock*2+p.position[0]/40)
+			ebitenutil.DrawRect(screen, x, y, snap(p.size[0]), snap(p.size[1]), p.faded(p.fade()*wave))
+		case sim.AmbientSolarWind:
+			ebitenutil.DrawRect(screen, x, y, p.size[0], p.size[1], p.faded(p.fade()))
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"0ms2/mixer"
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten/audio"
+	"io"
+)
+
+// sounds is silent until main picks a backend
+var sounds = newSounds(mixer.NullAudioBackend{})
+
+func newSounds(backend mixer.AudioBackend) *mixer.Audio {
+	return mixer.NewAudio(backend).SetVolumes(func() mixer.Volumes {
+		return mixer.Volumes{Master: settings.MasterVolume, Music: settings.MusicVolume, Sfx: settings.SfxVolume}
+	})
+}
+
+type ebitenAudioBackend struct {
+	context *audio.Context
+}
+
+// NewEbitenAudioBackend plays through the sound card, there can only be one.
+func NewEbitenAudioBackend() (mixer.AudioBackend, error) {
+	context, err := audio.NewContext(mixer.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ebitenAudioBackend{context: context}, nil
+}
+
+func (b *ebitenAudioBackend) NewPlayer(src io.ReadCloser) (mixer.AudioPlayer, error) {
+	p, err := audio.NewPlayer(b.context, src)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// playPickup chimes a powerup of puType being collected.
+func playPickup(puType sim.PowerupType) {
+	sound := mixer.SoundFuelPickup
+	if puType == sim.O2Type {
+		sound = mixer.SoundO2Pickup
+	}
+	sounds.Play(sound)
+}
+
+// flights are what the sounds follow of the players, a J0hn out of fuel
+// doesn't thrust.
+func flights(players []*sim.J0hn) []mixer.Flight {
+	var flights []mixer.Flight
+	for _, p := range players {
+		flights = append(flights, mixer.Flight{
+			Altitude:  p.RelativePosition[1],
+			Speed:     p.Velocity.Length(),
+			O2:        p.O2,
+			Thrusting: p.IsAccelerating && p.Fuel > 0,
+		})
+	}
+	return flights
+}
@@ -1,126 +1,218 @@
 package main
 
 import (
+	"0ms2/sim"
 	"github.com/hajimehoshi/ebiten"
-	log "github.com/sirupsen/logrus"
 	"github.com/ungerik/go3d/float64/vec2"
+	"image"
+	"math"
 )
 
-var (
-	positionCurrent vec2.T
-	positionN       = vec2.T{0, -windowHeight}
-	positionNE      = vec2.T{windowWidth, -windowHeight}
-	positionE       = vec2.T{windowWidth, 0}
-	positionW       = vec2.T{-windowWidth, 0}
-	positionNW      = vec2.T{-windowWidth, -windowHeight}
-)
+// backgroundPreloadRadius is how many cells around the player are kept loaded,
+// in every direction.
+const backgroundPreloadRadius = 1
+
+// groundRow is the first grid row under the ground, it and the rows below it
+// never get tiles. The rows above it are the sky J0hn lifts off through.
+const groundRow = sim.LiftOffRows + 1
 
+const pixelsPerKm = sim.PixelsPerKm
+
+// Background keeps its tiles in a grid index keyed by cell coordinates. Cell
+// (0, 0) is the top-left corner of the lift-off sky, y grows downwards. It
+// scrolls with the camera.
 type Background struct {
-	player          *J0hn
-	tiles           map[Tile]bool
-	timeAccumulator int64
-	FirstTile       Tile
+	camera          *sim.Camera
+	tiles           map[image.Point]Tile
+	timeAccumulator float64
+	// origin is the screen position of grid cell (0, 0)
+	origin        vec2.T
+	preloadRadius int
+	generator     *TileGenerator
+	// currentTile is the tile the camera is in
+	currentTile Tile
 }
 
-func NewBackgroundSystem(player *J0hn) *Background {
-	t := NewInitTile(windowWidth, windowHeight*3, 1)
-
+func NewBackgroundSystem(camera *sim.Camera) *Background {
 	p := &Background{
-		player: player,
-		tiles:  map[Tile]bool{t: true},
+		camera:        camera,
+		tiles:         map[image.Point]Tile{},
+		origin:        vec2.T{0, windowHeight * (1 - groundRow)},
+		preloadRadius: backgroundPreloadRadius,
 	}
 
-	p.FirstTile = t
-	p.player.currentTile = t
+	// altitude 0 is where J0hn stands before lifting off
+	p.generator = NewTileGenerator(runSeed, p.playerScreenCenter()[1]-p.origin[1])
+
+	current := p.playerCell()
+	p.preload(current)
+	p.currentTile = p.TileAt(current)
 	return p
 }
 
-func (bg *Background) Update(_ *ebiten.Image, delta int64) {
-	bg.timeAccumulator += delta
-
-	if float64(bg.timeAccumulator) >= playerTick {
-		bg.timeAccumulator = 0
-		tilesCollection := map[vec2.T]Tile{
-			positionCurrent: nil,
-			positionN:       nil,
-			positionNE:      nil,
-			positionNW:      nil,
-			positionE:       nil,
-			positionW:       nil,
-		}
-		for tile := range bg.tiles {
-			vel := copyVector(*bg.player.velocity)
-			vel.Scale(float64(playerTick) / 300)
+// SetPreloadRadius changes how many cells around the player are kept loaded.
+func (bg *Background) SetPreloadRadius(radius int) *Background {
+	if radius < 1 {
+		radius = 1
+	}
 
-			tile.Update(vel)
+	bg.preloadRadius = radius
+	return bg
+}
 
-			if !bg.player.isLifting {
-				for k := range tilesCollection {
-					pos := copyVector(bg.player.currentTile.GetPosition().Min)
-					pos.Add(&k).Add(&vec2.T{windowWidth / 2, windowHeight / 2})
-
-					if k == positionCurrent {
-						pos = copyVector(*bg.player.position)
-						pos.Scale(j0hnScale)
-					}
-
-					if tile.GetPosition().ContainsPoint(&pos) {
-						tilesCollection[k] = tile
-						break
-					}
-				}
-			}
+// TileAt returns the tile covering a cell, or nil when it isn't loaded.
+func (bg *Background) TileAt(cell image.Point) Tile {
+	return bg.tiles[cell]
+}
+
+// cellAt returns the grid cell containing a screen position.
+func (bg *Background) cellAt(pos vec2.T) image.Point {
+	return image.Point{
+		X: int(math.Floor((pos[0] - bg.origin[0]) / windowWidth)),
+		Y: int(math.Floor((pos[1] - bg.origin[1]) / windowHeight)),
+	}
+}
+
+// cellPosition returns the screen position of the top-left corner of a cell.
+func (bg *Background) cellPosition(cell image.Point) vec2.T {
+	return vec2.T{
+		bg.origin[0] + float64(cell.X*windowWidth),
+		bg.origin[1] + float64(cell.Y*windowHeight),
+	}
+}
+
+func (bg *Background) playerScreenCenter() vec2.T {
+	pos := copyVector(*bg.camera.Position)
+	pos.Scale(j0hnScale)
+	pos.Add(&vec2.T{playerSize * j0hnScale / 2, playerSize * j0hnScale / 2})
+
+	return pos
+}
+
+func (bg *Background) playerCell() image.Point {
+	return bg.cellAt(bg.playerScreenCenter())
+}
+
+// cellDistance is the distance in cells between two cells, measured along
+// the farthest axis.
+func cellDistance(a, b image.Point) int {
+	d := b.Sub(a)
+	if d.X < 0 {
+		d.X = -d.X
+	}
+	if d.Y < 0 {
+		d.Y = -d.Y
+	}
 
-			if tile == bg.FirstTile {
-				pos := *tile.GetPosition()
-				if pos.Min[1] > 0 {
-					bg.player.isLifting = false
-				}
+	if d.X > d.Y {
+		return d.X
+	}
+	return d.Y
+}
+
+// preload makes sure every cell within the preload radius has a tile, and
+// queues the ring right outside it on the tile generator.
+func (bg *Background) preload(center image.Point) {
+	r := bg.preloadRadius + 1
+	for y := center.Y - r; y <= center.Y+r; y++ {
+		if y >= groundRow {
+			break
+		}
+
+		for x := center.X - r; x <= center.X+r; x++ {
+			cell := image.Point{x, y}
+			if _, ok := bg.tiles[cell]; ok {
+				continue
 			}
 
-			// offscreen? then delete instance
-			if tile.IsOffscreen() {
-				log.WithField("id", tile.GetId()).Debugln("Killing Tile")
-				delete(bg.tiles, tile)
+			if cellDistance(center, cell) <= bg.preloadRadius {
+				bg.tiles[cell] = NewStarsTile(bg.cellPosition(cell), cell, bg.generator.Take(cell))
+			} else {
+				bg.generator.Request(cell)
 			}
 		}
+	}
+}
 
-		if !bg.player.isLifting && tilesCollection[positionCurrent] == nil {
-			log.WithFields(map[string]interface{}{
-				"player_position": bg.player.collitionBox,
-				"last_tile":       bg.player.currentTile.GetPosition(),
-			}).Error("impossible to locate the current tile")
-		} else if bg.player.isLifting {
-		} else {
-			if bg.player.currentTile.GetId() != tilesCollection[positionCurrent].GetId() {
-				log.WithFields(map[string]interface{}{
-					"player_position": bg.player.collitionBox,
-					"last_tile":       tilesCollection[positionCurrent].GetPosition(),
-				}).Tracef("%v contains player", tilesCollection[positionCurrent].GetId())
-				bg.player.currentTile = tilesCollection[positionCurrent]
-			}
+// evict drops tiles that are more than one cell past the preload radius, the
+// extra cell stops tiles on the border from being rebuilt back and forth.
+// Generation still pending for those cells is cancelled too.
+func (bg *Background) evict(center image.Point) {
+	limit := bg.preloadRadius + 1
+	bg.generator.Retain(func(cell image.Point) bool {
+		return cellDistance(center, cell) <= limit
+	})
+
+	for cell, tile := range bg.tiles {
+		if cellDistance(center, cell) > limit {
+			backgroundLog.WithFields(map[string]interface{}{
+				"id":   tile.GetId(),
+				"cell": cell,
+			}).Debugln("Killing Tile")
+			tile.Dispose()
+			delete(bg.tiles, cell)
+		}
+	}
+}
 
-			for k, v := range tilesCollection {
-				if k == positionCurrent || v != nil {
-					continue
-				}
+func (bg *Background) Update(_ *ebiten.Image, delta int64) {
+	bg.timeAccumulator += float64(delta)
 
-				pos := copyVector(bg.player.currentTile.GetPosition().Min)
-				pos.Add(&k)
-				t := NewStarsTile(pos)
-				bg.tiles[t] = true
-			}
+	for bg.timeAccumulator >= sim.Tick {
+		bg.timeAccumulator -= sim.Tick
+		bg.generator.Collect()
+
+		vel := copyVector(*bg.camera.Velocity)
+		vel.Scale(float64(sim.Tick) / 300)
+		bg.origin.Add(&vel)
+
+		for _, tile := range bg.tiles {
+			tile.Update(vel)
 		}
 
-		log.WithFields(map[string]interface{}{
+		current := bg.playerCell()
+		bg.preload(current)
+		bg.evict(current)
+
+		if tile := bg.TileAt(current); tile != nil && tile != bg.currentTile {
+			backgroundLog.WithFields(map[string]interface{}{
+				"cell":      current,
+				"last_tile": tile.GetPosition(),
+			}).Tracef("%v contains player", tile.GetId())
+			bg.currentTile = tile
+		}
+
+		backgroundLog.WithFields(map[string]interface{}{
 			"tiles_counter": len(bg.tiles),
 		}).Traceln("Active tiles")
 	}
 }
 
 func (bg *Background) Draw(screen *ebiten.Image) {
-	for t := range bg.tiles {
+	for _, t := range bg.tiles {
 		t.Draw(screen)
-		//fmt.Printf("%#v: %#v\n", k, t.op.GeoM)
+	}
+}
+
+// Shift scrolls the whole sky by offset pixels at once, as if J0hn had flown
+// there, and loads the tiles around him.
+func (bg *Background) Shift(offset vec2.T) {
+	bg.origin.Add(&offset)
+	for _, tile := range bg.tiles {
+		tile.Update(offset)
+	}
+
+	current := bg.playerCell()
+	bg.evict(current)
+	bg.preload(current)
+	bg.currentTile = bg.TileAt(current)
+}
+
+// Close stops the tile workers and frees the tiles once the run is over.
+func (bg *Background) Close() {
+	bg.generator.Close()
+	for cell, tile := range bg.tiles {
+		tile.Dispose()
+		delete(bg.tiles, cell)
 	}
 }
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+)
+
+// CameraView runs a Camera in the game loop, it draws nothing.
+type CameraView struct {
+	*sim.Camera
+}
+
+func (v CameraView) Update(_ *ebiten.Image, delta int64) {
+	v.Camera.Update(delta)
+}
+
+func (v CameraView) Draw(*ebiten.Image) {}
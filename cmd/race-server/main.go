@@ -0,0 +1,36 @@
+// Command race-server runs the network races of the game without a window,
+// pilots join it with the game's -join flag.
+package main
+
+import (
+	"0ms2/sim"
+	"flag"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	addr := flag.String("addr", sim.RaceDefaultAddr, "address the pilots join on")
+	arcade := flag.Bool("arcade", false, "race with the arcade physics, no gravity")
+	level := flag.String("log-level", log.InfoLevel.String(), "logrus level of the server log")
+	flag.Parse()
+
+	lvl, err := log.ParseLevel(*level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.SetLevel(lvl)
+
+	physics := sim.PhysicsAtmospheric
+	if *arcade {
+		physics = sim.PhysicsArcade
+	}
+
+	server, err := sim.NewRaceServer(*addr, physics, sim.DefaultTuning())
+	if err != nil {
+		log.Fatal(err)
+	}
+	sim.NetLog.WithField("addr", server.Addr()).Infoln("race server listening")
+	if err := server.Serve(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"0ms2/sim"
+	"bufio"
+	"fmt"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	log "github.com/sirupsen/logrus"
+	"github.com/ungerik/go3d/float64/vec2"
+	"image/color"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const consoleKey = ebiten.KeyGraveAccent
+
+// consoleHistory is how many output lines the console remembers
+const consoleHistory = 200
+
+// consoleScript runs when the game starts, from the config folder
+const consoleScript = "autoexec.cfg"
+
+var consoleColor = color.NRGBA{0x22, 0x20, 0x34, 0xe0}
+
+// TuningVar is a value the console can read and write while the game runs.
+type TuningVar struct {
+	Help string
+	Get  func() float64
+	Set  func(float64)
+}
+
+var tuningVars = make(map[string]*TuningVar)
+
+// RegisterTuning exposes v to the console's get and set commands.
+func RegisterTuning(name, help string, v *float64) {
+	RegisterTuningFunc(name, help, func() float64 { return *v }, func(f float64) { *v = f })
+}
+
+func RegisterTuningFunc(name, help string, get func() float64, set func(float64)) {
+	tuningVars[name] = &TuningVar{Help: help, Get: get, Set: set}
+}
+
+// ConsoleCommand runs with the words typed after its name, what it returns
+// is printed.
+type ConsoleCommand struct {
+	Usage string
+	Help  string
+	Run   func(args []string) (string, error)
+}
+
+// Console is the drop-down developer console. It freezes the run while open
+// so typing doesn't fly J0hn around.
+type Console struct {
+	Open bool
+
+	game       *Game
+	commands   map[string]*ConsoleCommand
+	output     []string
+	line       string
+	history    []string
+	historyPos int
+}
+
+func NewConsole(game *Game) *Console {
+	c := &Console{
+		game:     game,
+		commands: make(map[string]*ConsoleCommand),
+	}
+	c.registerCommands()
+
+	return c
+}
+
+func (c *Console) Register(name string, cmd *ConsoleCommand) {
+	c.commands[name] = cmd
+}
+
+func (c *Console) Printf(format string, args ...interface{}) {
+	for _, line := range strings.Split(fmt.Sprintf(format, args...), "\n") {
+		c.output = append(c.output, line)
+	}
+
+	if len(c.output) > consoleHistory {
+		c.output = c.output[len(c.output)-consoleHistory:]
+	}
+}
+
+// Execute runs a line of commands separated by semicolons.
+func (c *Console) Execute(line string) {
+	for _, statement := range strings.Split(line, ";") {
+		words := strings.Fields(statement)
+		if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+			continue
+		}
+
+		log.WithField("command", statement).Debugln("console")
+		cmd, ok := c.commands[words[0]]
+		if !ok {
+			c.Printf("unknown command %q, try help", words[0])
+			continue
+		}
+
+		out, err := cmd.Run(words[1:])
+		if err != nil {
+			c.Printf("%s: %v\nusage: %s %s", words[0], err, words[0], cmd.Usage)
+		} else if out != "" {
+			c.Printf("%s", out)
+		}
+	}
+}
+
+// Exec runs every line of a script file.
+func (c *Console) Exec(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		c.Execute(scanner.Text())
+	}
+
+	return scanner.Err()
+}
+
+// RunStartupScript runs the script at path, or consoleScript from the config
+// folder if path is empty and there is one.
+func (c *Console) RunStartupScript(path string) {
+	if path == "" {
+		p, err := configPath(consoleScript)
+		if err != nil {
+			return
+		}
+		if _, err := os.Stat(p); err != nil {
+			return
+		}
+		path = p
+	}
+
+	if err := c.Exec(path); err != nil {
+		log.WithField("script", path).Errorln("startup script failed:", err)
+	}
+}
+
+// repeating reports whether a held key should act on this frame.
+func repeating(key ebiten.Key) bool {
+	d := inpututil.KeyPressDuration(key)
+	return d == 1 || (d > 30 && d%3 == 0)
+}
+
+// Update handles the console keys and typing, it reports whether the console
+// is open.
+func (c *Console) Update() bool {
+	if !c.Open {
+		if inpututil.IsKeyJustPressed(consoleKey) {
+			c.Open = true
+		}
+		// the key that opened the console is typed too, skip it
+		return c.Open
+	}
+
+	if inpututil.IsKeyJustPressed(consoleKey) || inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		c.Open = false
+		// keys typed in the console mustn't act in the game
+		input.Latch(ActionThrust)
+		input.Latch(ActionPause)
+		input.Latch(ActionConfirm)
+		return false
+	}
+
+	c.line += string(ebiten.InputChars())
+
+	switch {
+	case repeating(ebiten.KeyBackspace) && len(c.line) > 0:
+		runes := []rune(c.line)
+		c.line = string(runes[:len(runes)-1])
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		c.Printf("> %s", c.line)
+		if strings.TrimSpace(c.line) != "" {
+			c.history = append(c.history, c.line)
+		}
+		c.Execute(c.line)
+		c.line = ""
+		c.historyPos = len(c.history)
+	case repeating(ebiten.KeyUp) && c.historyPos > 0:
+		c.historyPos--
+		c.line = c.history[c.historyPos]
+	case repeating(ebiten.KeyDown) && c.historyPos < len(c.history):
+		c.historyPos++
+		c.line = ""
+		if c.historyPos < len(c.history) {
+			c.line = c.history[c.historyPos]
+		}
+	}
+
+	return true
+}
+
+// Draw drops the console over the top half of the screen.
+func (c *Console) Draw(screen *ebiten.Image) {
+	if !c.Open {
+		return
+	}
+
+	w, h := screen.Size()
+	height := h / 2
+	ebitenutil.DrawRect(screen, 0, 0, float64(w), float64(height), consoleColor)
+
+	rows := height/debugLineHeight - 1
+	start := len(c.output) - rows
+	if start < 0 {
+		start = 0
+	}
+
+	ebitenutil.DebugPrintAt(screen, strings.Join(c.output[start:], "\n"), 8, 4)
+	ebitenutil.DebugPrintAt(screen, "> "+c.line+"_", 8, height-debugLineHeight-4)
+}
+
+func parseOnOff(args []string) (bool, error) {
+	if len(args) != 1 {
+		return false, fmt.Errorf("expected on or off")
+	}
+
+	switch args[0] {
+	case "on", "1", "true":
+		return true, nil
+	case "off", "0", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected on or off, got %q", args[0])
+}
+
+func parseFloats(args []string, n int) ([]float64, error) {
+	if len(args) != n {
+		return nil, fmt.Errorf("expected %d numbers", n)
+	}
+
+	values := make([]float64, n)
+	for i, arg := range args {
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	return values, nil
+}
+
+func (c *Console) registerCommands() {
+	g := c.game
+
+	// the players change every run, these follow the current ones
+	RegisterTuningFunc("o2", "J0hn's oxygen, 0 to 100",
+		func() float64 { return g.player.O2 },
+		func(v float64) {
+			for _, p := range g.players {
+				p.O2 = v
+			}
+		})
+	RegisterTuningFunc("fuel", "J0hn's fuel, 0 to 100",
+		func() float64 { return g.player.Fuel },
+		func(v float64) {
+			for _, p := range g.players {
+				p.Fuel = v
+			}
+		})
+
+	c.Register("help", &ConsoleCommand{Usage: "[command]", Help: "list commands or explain one",
+		Run: func(args []string) (string, error) {
+			if len(args) == 1 {
+				cmd, ok := c.commands[args[0]]
+				if !ok {
+					return "", fmt.Errorf("unknown command %q", args[0])
+				}
+				return fmt.Sprintf("%s %s\n  %s", args[0], cmd.Usage, cmd.Help), nil
+			}
+
+			var names []string
+			for name := range c.commands {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			var lines []string
+			for _, name := range names {
+				lines = append(lines, fmt.Sprintf("%-10s %s", name, c.commands[name].Help))
+			}
+			return strings.Join(lines, "\n"), nil
+		}})
+
+	c.Register("vars", &ConsoleCommand{Help: "list tuning variables",
+		Run: func([]string) (string, error) {
+			var names []string
+			for name := range tuningVars {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			var lines []string
+			for _, name := range names {
+				v := tuningVars[name]
+				lines = append(lines, fmt.Sprintf("%-22s %-10g %s", name, v.Get(), v.Help))
+			}
+			return strings.Join(lines, "\n"), nil
+		}})
+
+	c.Register("get", &ConsoleCommand{Usage: "<var>", Help: "print a tuning variable",
+		Run: func(args []string) (string, error) {
+			if len(args) != 1 {
+				return "", fmt.Errorf("expected a variable")
+			}
+			v, ok := tuningVars[args[0]]
+			if !ok {
+				return "", fmt.Errorf("unknown variable %q, try vars", args[0])
+			}
+			return fmt.Sprintf("%s = %g", args[0], v.Get()), nil
+		}})
+
+	c.Register("set", &ConsoleCommand{Usage: "<var> <value>", Help: "change a tuning variable",
+		Run: func(args []string) (string, error) {
+			if len(args) != 2 {
+				return "", fmt.Errorf("expected a variable and a value")
+			}
+			v, ok := tuningVars[args[0]]
+			if !ok {
+				return "", fmt.Errorf("unknown variable %q, try vars", args[0])
+			}
+			f, err := strconv.ParseFloat(args[1], 64)
+			if err != nil {
+				return "", err
+			}
+			v.Set(f)
+			return fmt.Sprintf("%s = %g", args[0], v.Get()), nil
+		}})
+
+	c.Register("god", &ConsoleCommand{Usage: "on|off", Help: "J0hn never runs out of o2 or fuel",
+		Run: func(args []string) (string, error) {
+			on, err := parseOnOff(args)
+			if err != nil {
+				return "", err
+			}
+			g.SetGodMode(on)
+			return "god " + onOffWord(on), nil
+		}})
+
+	c.Register("teleport", &ConsoleCommand{Usage: "<x> <y>", Help: "move J0hn to a position in km, y is the altitude",
+		Run: func(args []string) (string, error) {
+			pos, err := parseFloats(args, 2)
+			if err != nil {
+				return "", err
+			}
+			g.Teleport(vec2.T{pos[0], pos[1]})
+			return fmt.Sprintf("J0hn is at %g, %g", pos[0], pos[1]), nil
+		}})
+
+	c.Register("spawn", &ConsoleCommand{Usage: "powerup fuel|o2 | planet", Help: "spawn a powerup or a planet",
+		Run: func(args []string) (string, error) {
+			switch {
+			case len(args) == 1 && args[0] == "planet":
+				p := g.planets.Spawn()
+				return fmt.Sprintf("planet #%d", p.ID), nil
+			case len(args) == 2 && args[0] == "powerup" && (args[1] == string(sim.FuelType) || args[1] == string(sim.O2Type)):
+				p := g.powerups.Spawn(sim.PowerupType(args[1]))
+				return fmt.Sprintf("%s powerup #%d", p.Type, p.ID), nil
+			}
+			return "", fmt.Errorf("nothing to spawn")
+		}})
+
+	c.Register("timescale", &ConsoleCommand{Usage: "[scale]", Help: "speed the simulation up or down, 1 is normal",
+		Run: func(args []string) (string, error) {
+			if len(args) == 1 {
+				scale, err := parseFloats(args, 1)
+				if err != nil {
+					return "", err
+				}
+				if scale[0] < 0 {
+					return "", fmt.Errorf("scale can't be negative")
+				}
+				g.timeScale = scale[0]
+			}
+			return fmt.Sprintf("timescale = %g", g.timeScale), nil
+		}})
+
+	c.Register("seed", &ConsoleCommand{Usage: "[seed]", Help: "print the run seed, or restart the run with one",
+		Run: func(args []string) (string, error) {
+			if len(args) == 1 {
+				seed, err := strconv.ParseInt(args[0], 10, 64)
+				if err != nil {
+					return "", err
+				}
+				running := g.running
+				g.endRun()
+				g.newRun(seed)
+				if running {
+					g.startRun()
+				}
+			}
+			return fmt.Sprintf("seed = %d", runSeed), nil
+		}})
+
+	c.Register("play", &ConsoleCommand{Help: "close the menus and start the run",
+		Run: func([]string) (string, error) {
+			g.startRun()
+			return "", nil
+		}})
+
+	c.Register("metrics", &ConsoleCommand{Usage: "graph on|off | export <file.csv|file.json>", Help: "show frame timings or save them",
+		Run: func(args []string) (string, error) {
+			switch {
+			case len(args) == 2 && args[0] == "graph":
+				on, err := parseOnOff(args[1:])
+				if err != nil {
+					return "", err
+				}
+				g.metrics.ShowGraph = on
+				return "metrics graph " + onOffWord(on), nil
+			case len(args) == 2 && args[0] == "export":
+				if err := g.metrics.Export(args[1]); err != nil {
+					return "", err
+				}
+				return "metrics saved to " + args[1], nil
+			}
+			return "", fmt.Errorf("expected graph or export")
+		}})
+
+	c.Register("ghost", &ConsoleCommand{Usage: "load <file> | save <file> | best", Help: "race a ghost file, share the raced ghost or go back to the best",
+		Run: func(args []string) (string, error) {
+			switch {
+			case len(args) == 2 && args[0] == "load":
+				run, err := LoadGhost(args[1])
+				if err != nil {
+					return "", err
+				}
+				g.RaceGhost(run)
+				return fmt.Sprintf("racing %s, %s, seed = %d", args[1], FormatDistance(run.Altitude), run.Seed), nil
+			case len(args) == 2 && args[0] == "save":
+				run := g.ghosts.Ghost()
+				if run == nil {
+					return "", fmt.Errorf("no ghost to save")
+				}
+				if err := run.Save(args[1]); err != nil {
+					return "", err
+				}
+				return "ghost saved to " + args[1], nil
+			case len(args) == 1 && args[0] == "best":
+				g.RaceGhost(nil)
+				return "racing the best run", nil
+			}
+			return "", fmt.Errorf("expected load, save or best")
+		}})
+
+	c.Register("race", &ConsoleCommand{Usage: "host [addr] [name] | join <addr> [name] | leave", Help: "race other pilots over the network",
+		Run: func(args []string) (string, error) {
+			name := sim.DefaultPilotName
+			switch {
+			case len(args) >= 1 && len(args) <= 3 && args[0] == "host":
+				addr := sim.RaceDefaultAddr
+				if len(args) > 1 {
+					addr = args[1]
+				}
+				if len(args) > 2 {
+					name = args[2]
+				}
+				if err := g.HostRace(addr, name); err != nil {
+					return "", err
+				}
+				return "hosting on " + g.server.Addr(), nil
+			case len(args) >= 2 && len(args) <= 3 && args[0] == "join":
+				if len(args) > 2 {
+					name = args[2]
+				}
+				if err := g.JoinRace(args[1], name); err != nil {
+					return "", err
+				}
+				return "joined " + args[1] + ", racing from the next race", nil
+			case len(args) == 1 && args[0] == "leave":
+				g.LeaveRace()
+				return "racing offline", nil
+			}
+			return "", fmt.Errorf("expected host, join or leave")
+		}})
+
+	c.Register("exec", &ConsoleCommand{Usage: "<file>", Help: "run the commands of a script",
+		Run: func(args []string) (string, error) {
+			if len(args) != 1 {
+				return "", fmt.Errorf("expected a file")
+			}
+			return "", c.Exec(args[0])
+		}})
+
+	c.Register("clear", &ConsoleCommand{Help: "clear the console",
+		Run: func([]string) (string, error) {
+			c.output = nil
+			return "", nil
+		}})
+}
+
+func onOffWord(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -1,19 +1,24 @@
 package main
 
+import "0ms2/sim"
+
 const (
 	// Window params
-	windowWidth  = 800
-	windowHeight = 600
+	windowWidth  = sim.ScreenWidth
+	windowHeight = sim.ScreenHeight
 	gameTitle    = "- 0ms2 = 0m/s^2 -"
 
+	defaultDisplayMode = DisplayResizable
+
 	// Sprites settings
-	playerSize      = 64
+	playerSize      = sim.PlayerSize
 	spritesPath     = "sprites"
 	j0hnSpriteFile  = "j0hn.png"
-	j0hnScale       = 3.0
+	j0hnScale       = sim.J0hnScale
 	starsProportion = 0.0005
 
+	defaultPhysicsMode = sim.PhysicsAtmospheric
+
 	platformSpriteFile = "Platform.png"
 	platformSize       = 64
-	DrawCollitionBoxes = true
 )
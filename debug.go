@@ -0,0 +1,282 @@
+package main
+
+import (
+	"0ms2/sim"
+	"fmt"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/ungerik/go3d/float64/vec2"
+	"image/color"
+	"sort"
+	"strings"
+)
+
+// The debug keys are fixed, they aren't player controls
+const debugOverlayKey = ebiten.KeyF3
+const debugInspectorKey = ebiten.KeyF4
+
+// debugLineHeight is the line height of ebitenutil's debug font
+const debugLineHeight = 16
+
+// debugVectorScale stretches velocity vectors so slow movement is visible
+const debugVectorScale = 10
+
+var debugPlayerColor = color.NRGBA{0xff, 0x70, 0x70, 0xff}
+var debugPowerupColor = color.NRGBA{0x70, 0x70, 0xff, 0xff}
+var debugPlanetColor = color.NRGBA{0x99, 0xe5, 0x50, 0xff}
+var debugPlatformColor = color.NRGBA{0xdf, 0x71, 0x26, 0xff}
+var debugTileColor = color.NRGBA{0xff, 0xff, 0xff, 0x60}
+var debugVelocityColor = color.NRGBA{0xfb, 0xf2, 0x36, 0xff}
+var debugPanelColor = color.NRGBA{0x00, 0x00, 0x00, 0xb0}
+
+// DebugOverlay draws what the game knows on top of what it shows: colliders,
+// the background grid, velocities and the player state. Its inspector pauses
+// the run and lists every planet and powerup.
+type DebugOverlay struct {
+	Enabled    bool
+	Inspecting bool
+	scroll     int
+
+	camera     *sim.Camera
+	player     *sim.J0hn
+	background *Background
+	ambient    *Ambient
+	planets    *sim.PlanetsSpawner
+	powerups   *sim.PowerupsSpawner
+	platform   *Platform
+	particles  *Particles
+}
+
+func NewDebugOverlay() *DebugOverlay {
+	return &DebugOverlay{}
+}
+
+// Watch points the overlay to the entities of a new run, the panel shows
+// player 1.
+func (d *DebugOverlay) Watch(camera *sim.Camera, background *Background, ambient *Ambient,
+	planets *sim.PlanetsSpawner, powerups *sim.PowerupsSpawner, platform *Platform, particles *Particles) {
+	d.camera = camera
+	d.player = camera.Players()[0]
+	d.background = background
+	d.ambient = ambient
+	d.planets = planets
+	d.powerups = powerups
+	d.platform = platform
+	d.particles = particles
+}
+
+// Update handles the debug keys, it reports whether the inspector is open
+// so the caller freezes the run.
+func (d *DebugOverlay) Update() bool {
+	if inpututil.IsKeyJustPressed(debugOverlayKey) {
+		d.Enabled = !d.Enabled
+	}
+
+	if inpututil.IsKeyJustPressed(debugInspectorKey) {
+		d.Inspecting = !d.Inspecting
+		d.scroll = 0
+	}
+
+	if d.Inspecting {
+		if input.JustPressed(ActionUp) && d.scroll > 0 {
+			d.scroll--
+		} else if input.JustPressed(ActionDown) {
+			d.scroll++
+		}
+	}
+
+	return d.Inspecting
+}
+
+func drawOutline(dst *ebiten.Image, r vec2.Rect, c color.Color) {
+	ebitenutil.DrawLine(dst, r.Min[0], r.Min[1], r.Max[0], r.Min[1], c)
+	ebitenutil.DrawLine(dst, r.Max[0], r.Min[1], r.Max[0], r.Max[1], c)
+	ebitenutil.DrawLine(dst, r.Max[0], r.Max[1], r.Min[0], r.Max[1], c)
+	ebitenutil.DrawLine(dst, r.Min[0], r.Max[1], r.Min[0], r.Min[1], c)
+}
+
+// drawVector draws velocity v from the center of r, scaled to be visible.
+func drawVector(dst *ebiten.Image, r vec2.Rect, v vec2.T, c color.Color) {
+	center := vec2.T{(r.Min[0] + r.Max[0]) / 2, (r.Min[1] + r.Max[1]) / 2}
+	ebitenutil.DrawLine(dst, center[0], center[1],
+		center[0]+v[0]*debugVectorScale, center[1]+v[1]*debugVectorScale, c)
+}
+
+// planetBox is the screen area of a planet, planets don't collide so they
+// keep none of their own.
+func planetBox(planet *sim.Planet) vec2.Rect {
+	min := copyVector(planet.Position)
+	min.Scale(sim.PlanetScale)
+	max := copyVector(min)
+	max.Add(&vec2.T{sim.PlanetSize * sim.PlanetScale, sim.PlanetSize * sim.PlanetScale})
+
+	return vec2.Rect{Min: min, Max: max}
+}
+
+func sortedPlanets(planets map[uint]*sim.Planet) []*sim.Planet {
+	list := make([]*sim.Planet, 0, len(planets))
+	for _, planet := range planets {
+		list = append(list, planet)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list
+}
+
+func sortedPowerups(powerups map[uint]*sim.Powerup) []*sim.Powerup {
+	list := make([]*sim.Powerup, 0, len(powerups))
+	for _, powerup := range powerups {
+		list = append(list, powerup)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list
+}
+
+// DrawWorld draws the overlay parts living in the world: the tile grid,
+// colliders and velocities.
+func (d *DebugOverlay) DrawWorld(world *ebiten.Image) {
+	if !d.Enabled || d.player == nil {
+		return
+	}
+
+	for cell, tile := range d.background.tiles {
+		bounds := *tile.GetPosition()
+		drawOutline(world, bounds, debugTileColor)
+		ebitenutil.DebugPrintAt(world, fmt.Sprintf("%v %.8s", cell, tile.GetId()),
+			int(bounds.Min[0])+4, int(bounds.Min[1])+4)
+	}
+
+	// planets and powerups move with the sky, scaled down by their influence
+	for _, planet := range d.planets.Drawable {
+		v := copyVector(*d.camera.Velocity)
+		v.Scale(planet.PlayerInfluence).Add(&planet.Velocity).Scale(sim.PlanetScale)
+		box := planetBox(planet)
+		drawOutline(world, box, debugPlanetColor)
+		drawVector(world, box, v, debugVelocityColor)
+	}
+
+	for _, powerup := range d.powerups.Drawable {
+		v := copyVector(*d.camera.Velocity)
+		v.Scale(powerup.PlayerInfluence).Add(&powerup.Velocity).Scale(sim.PowerupScale)
+		drawOutline(world, powerup.Box, debugPowerupColor)
+		drawVector(world, powerup.Box, v, debugVelocityColor)
+	}
+
+	platformMin := copyVector(d.platform.position)
+	platformMin.Scale(j0hnScale)
+	platformMax := copyVector(platformMin)
+	platformMax.Add(&vec2.T{platformSize * j0hnScale, platformSize * j0hnScale})
+	drawOutline(world, vec2.Rect{Min: platformMin, Max: platformMax}, debugPlatformColor)
+
+	// the sky scrolls by the camera velocity, the J0hns head the other way
+	for _, p := range d.camera.Players() {
+		box := p.CollitionBox()
+		drawOutline(world, box, debugPlayerColor)
+		v := copyVector(*p.Velocity)
+		v.Scale(-float64(sim.Tick) / 300)
+		drawVector(world, box, v, debugVelocityColor)
+	}
+}
+
+// drawPanel prints lines over a dark box at x, y.
+func drawPanel(screen *ebiten.Image, lines []string, x, y int) {
+	width := 0
+	for _, line := range lines {
+		if len(line) > width {
+			width = len(line)
+		}
+	}
+
+	// the debug font is 6 pixels wide
+	ebitenutil.DrawRect(screen, float64(x-4), float64(y-2), float64(width*6+8), float64(len(lines)*debugLineHeight+4), debugPanelColor)
+	ebitenutil.DebugPrintAt(screen, strings.Join(lines, "\n"), x, y)
+}
+
+// DrawScreen draws the overlay text, the player state and entity counts or
+// the inspector.
+func (d *DebugOverlay) DrawScreen(screen *ebiten.Image) {
+	if d.player == nil {
+		return
+	}
+
+	w, h := screen.Size()
+	if d.Inspecting {
+		d.drawInspector(screen, w, h)
+		return
+	}
+
+	if !d.Enabled {
+		return
+	}
+
+	j := d.player
+	zone, _, _ := sim.AtmosphereAt(j.RelativePosition[1])
+	lines := []string{
+		"J0HN",
+		fmt.Sprintf("position   %.1f, %.1f", j.Position[0], j.Position[1]),
+		fmt.Sprintf("relative   %.2f, %.2f", j.RelativePosition[0], j.RelativePosition[1]),
+		fmt.Sprintf("velocity   %.2f, %.2f", j.Velocity[0], j.Velocity[1]),
+		fmt.Sprintf("accel      %.3f, %.3f", j.Acceleration[0], j.Acceleration[1]),
+		fmt.Sprintf("rotation   %.2f", j.Rotation),
+		fmt.Sprintf("o2 %.1f  fuel %.1f", j.O2, j.Fuel),
+		fmt.Sprintf("flying %v  lifting %v  accel %v", j.Flying, j.IsLifting, j.IsAccelerating),
+		fmt.Sprintf("physics    %v", j.Physics),
+		fmt.Sprintf("zone       %v", zone.Name),
+		fmt.Sprintf("players    %d  camera %.2f, %.2f", len(d.camera.Players()),
+			d.camera.RelativePosition[0], d.camera.RelativePosition[1]),
+		"",
+		"ENTITIES",
+		fmt.Sprintf("tiles      %d (%d queued, %d ready)", len(d.background.tiles),
+			len(d.background.generator.pending), len(d.background.generator.ready)),
+		fmt.Sprintf("planets    %d (%d drawn)", len(d.planets.Active), len(d.planets.Drawable)),
+		fmt.Sprintf("powerups   %d (%d drawn)", len(d.powerups.Active), len(d.powerups.Drawable)),
+		fmt.Sprintf("ambient    %d", len(d.ambient.particles)),
+		fmt.Sprintf("particles  %d/%d", d.particles.Live(), particlePoolSize),
+		"",
+		"F3 overlay  F4 inspector",
+	}
+
+	drawPanel(screen, lines, w-250, h/2-len(lines)*debugLineHeight/2)
+}
+
+func (d *DebugOverlay) drawInspector(screen *ebiten.Image, w, h int) {
+	planets := sortedPlanets(d.planets.Active)
+	powerups := sortedPowerups(d.powerups.Active)
+
+	lines := []string{fmt.Sprintf("PLANETS (%d)", len(planets))}
+	for _, p := range planets {
+		lines = append(lines, fmt.Sprintf("#%-4d pos %7.1f,%7.1f  vel %5.2f,%5.2f  influence %.4f",
+			p.ID, p.Position[0], p.Position[1], p.Velocity[0], p.Velocity[1], p.PlayerInfluence))
+	}
+
+	lines = append(lines, "", fmt.Sprintf("POWERUPS (%d)", len(powerups)))
+	for _, p := range powerups {
+		lines = append(lines, fmt.Sprintf("#%-4d %-4s pos %7.1f,%7.1f  vel %5.2f,%5.2f  influence %.4f  box %.0f,%.0f-%.0f,%.0f",
+			p.ID, p.Type, p.Position[0], p.Position[1], p.Velocity[0], p.Velocity[1], p.PlayerInfluence,
+			p.Box.Min[0], p.Box.Min[1], p.Box.Max[0], p.Box.Max[1]))
+	}
+
+	// keep the header and footer, scroll what's between
+	visible := h/debugLineHeight - 4
+	if visible < 1 {
+		visible = 1
+	}
+	if max := len(lines) - visible; d.scroll > max {
+		d.scroll = max
+	}
+	if d.scroll < 0 {
+		d.scroll = 0
+	}
+	end := d.scroll + visible
+	if end > len(lines) {
+		end = len(lines)
+	}
+
+	page := append([]string{"INSPECTOR - paused", ""}, lines[d.scroll:end]...)
+	page = append(page, "", "up/down scroll  F4 resume")
+
+	ebitenutil.DrawRect(screen, 0, 0, float64(w), float64(h), debugPanelColor)
+	ebitenutil.DebugPrintAt(screen, strings.Join(page, "\n"), 8, 4)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"github.com/ungerik/go3d/float64/vec3"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// DitherMode picks the threshold map used when a gradient is rasterised.
+type DitherMode int
+
+const (
+	DitherNone DitherMode = iota
+	// DitherBayer uses an 8×8 ordered matrix, crisp and regular like pixel art
+	DitherBayer
+	// DitherBlueNoise uses a tiling void-and-cluster texture, no visible pattern
+	DitherBlueNoise
+)
+
+// RasterOptions controls how a gradient becomes pixels. With a Palette every
+// pixel is snapped to one of its colours, dithering between the two closest.
+// PixelSize groups screen pixels into blocks so the output matches scaled up
+// sprites.
+type RasterOptions struct {
+	Dither    DitherMode
+	Palette   color.Palette
+	PixelSize int
+}
+
+// DB32Palette is the DawnBringer 32 palette the sprites are drawn with.
+var DB32Palette = color.Palette{
+	color.RGBA{0x00, 0x00, 0x00, 0xFF}, color.RGBA{0x22, 0x20, 0x34, 0xFF},
+	color.RGBA{0x45, 0x28, 0x3c, 0xFF}, color.RGBA{0x66, 0x39, 0x31, 0xFF},
+	color.RGBA{0x8f, 0x56, 0x3b, 0xFF}, color.RGBA{0xdf, 0x71, 0x26, 0xFF},
+	color.RGBA{0xd9, 0xa0, 0x66, 0xFF}, color.RGBA{0xee, 0xc3, 0x9a, 0xFF},
+	color.RGBA{0xfb, 0xf2, 0x36, 0xFF}, color.RGBA{0x99, 0xe5, 0x50, 0xFF},
+	color.RGBA{0x6a, 0xbe, 0x30, 0xFF}, color.RGBA{0x37, 0x94, 0x6e, 0xFF},
+	color.RGBA{0x4b, 0x69, 0x2f, 0xFF}, color.RGBA{0x52, 0x4b, 0x24, 0xFF},
+	color.RGBA{0x32, 0x3c, 0x39, 0xFF}, color.RGBA{0x3f, 0x3f, 0x74, 0xFF},
+	color.RGBA{0x30, 0x60, 0x82, 0xFF}, color.RGBA{0x5b, 0x6e, 0xe1, 0xFF},
+	color.RGBA{0x63, 0x9b, 0xff, 0xFF}, color.RGBA{0x5f, 0xcd, 0xe4, 0xFF},
+	color.RGBA{0xcb, 0xdb, 0xfc, 0xFF}, color.RGBA{0xff, 0xff, 0xff, 0xFF},
+	color.RGBA{0x9b, 0xad, 0xb7, 0xFF}, color.RGBA{0x84, 0x7e, 0x87, 0xFF},
+	color.RGBA{0x69, 0x6a, 0x6a, 0xFF}, color.RGBA{0x59, 0x56, 0x52, 0xFF},
+	color.RGBA{0x76, 0x42, 0x8a, 0xFF}, color.RGBA{0xac, 0x32, 0x32, 0xFF},
+	color.RGBA{0xd9, 0x57, 0x63, 0xFF}, color.RGBA{0xd7, 0x7b, 0xba, 0xFF},
+	color.RGBA{0x8f, 0x97, 0x4a, 0xFF}, color.RGBA{0x8a, 0x6f, 0x30, 0xFF},
+}
+
+var bayer8 = [8][8]float64{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+const blueNoiseSize = 64
+const blueNoiseSigma = 1.5
+
+var blueNoise []float64
+var blueNoiseOnce sync.Once
+
+// ditherThreshold returns the threshold of a pixel in [0, 1). Both maps tile
+// over negative coordinates too.
+func ditherThreshold(mode DitherMode, x, y int) float64 {
+	switch mode {
+	case DitherBayer:
+		return (bayer8[y&7][x&7] + .5) / 64
+	case DitherBlueNoise:
+		blueNoiseOnce.Do(buildBlueNoise)
+		return blueNoise[(y&(blueNoiseSize-1))*blueNoiseSize+x&(blueNoiseSize-1)]
+	default:
+		return .5
+	}
+}
+
+// buildBlueNoise ranks every pixel of a tiling texture with the
+// void-and-cluster method: pixels are switched on one at a time in the
+// largest void, so any threshold leaves evenly spread points.
+func buildBlueNoise() {
+	const n = blueNoiseSize * blueNoiseSize
+
+	// toroidal gaussian kernel, indexed by offset
+	kernel := make([]float64, n)
+	for dy := 0; dy < blueNoiseSize; dy++ {
+		for dx := 0; dx < blueNoiseSize; dx++ {
+			wx := math.Min(float64(dx), float64(blueNoiseSize-dx))
+			wy := math.Min(float64(dy), float64(blueNoiseSize-dy))
+			kernel[dy*blueNoiseSize+dx] = math.Exp(-(wx*wx + wy*wy) / (2 * blueNoiseSigma * blueNoiseSigma))
+		}
+	}
+
+	on := make([]bool, n)
+	energy := make([]float64, n)
+	toggle := func(i int, state bool) {
+		on[i] = state
+		sign := 1.0
+		if !state {
+			sign = -1
+		}
+		ix, iy := i%blueNoiseSize, i/blueNoiseSize
+		for j := range energy {
+			dx := (j%blueNoiseSize - ix + blueNoiseSize) % blueNoiseSize
+			dy := (j/blueNoiseSize - iy + blueNoiseSize) % blueNoiseSize
+			energy[j] += sign * kernel[dy*blueNoiseSize+dx]
+		}
+	}
+	// tightest cluster is the densest on pixel, largest void the emptiest off one
+	extreme := func(state bool, densest bool) int {
+		best := -1
+		for i, e := range energy {
+			if on[i] != state {
+				continue
+			}
+			if best < 0 || (densest && e > energy[best]) || (!densest && e < energy[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	// fixed seed, the texture is the same on every run
+	rnd := rand.New(rand.NewSource(blueNoiseSize))
+	initial := n / 10
+	for count := 0; count < initial; {
+		if i := rnd.Intn(n); !on[i] {
+			toggle(i, true)
+			count++
+		}
+	}
+
+	// spread the initial points until moving one doesn't help anymore
+	for {
+		cluster := extreme(true, true)
+		toggle(cluster, false)
+		void := extreme(false, false)
+		if void == cluster {
+			toggle(cluster, true)
+			break
+		}
+		toggle(void, true)
+	}
+
+	rank := make([]int, n)
+	prototype := make([]bool, n)
+	copy(prototype, on)
+	protoEnergy := make([]float64, n)
+	copy(protoEnergy, energy)
+
+	for r := initial - 1; r >= 0; r-- {
+		i := extreme(true, true)
+		toggle(i, false)
+		rank[i] = r
+	}
+
+	copy(on, prototype)
+	copy(energy, protoEnergy)
+	for r := initial; r < n; r++ {
+		i := extreme(false, false)
+		toggle(i, true)
+		rank[i] = r
+	}
+
+	blueNoise = make([]float64, n)
+	for i, r := range rank {
+		blueNoise[i] = (float64(r) + .5) / n
+	}
+}
+
+func paletteUnit(c color.Color) vec3.T {
+	r, g, b, _ := c.RGBA()
+	return vec3.T{float64(r) / 0xFFFF, float64(g) / 0xFFFF, float64(b) / 0xFFFF}
+}
+
+// paletteMix finds the two palette colours closest to c and how far c lies
+// from the first towards the second, in [0, 1].
+func paletteMix(palette []vec3.T, c vec3.T) (int, int, float64) {
+	first, second := -1, -1
+	var firstD, secondD float64
+	for i, p := range palette {
+		d := vec3.SquareDistance(&p, &c)
+		if first < 0 || d < firstD {
+			second, secondD = first, firstD
+			first, firstD = i, d
+		} else if second < 0 || d < secondD {
+			second, secondD = i, d
+		}
+	}
+
+	if second < 0 {
+		return first, first, 0
+	}
+
+	a, b := palette[first], palette[second]
+	ab := vec3.Sub(&b, &a)
+	ac := vec3.Sub(&c, &a)
+	l := ab.LengthSqr()
+	if l == 0 {
+		return first, second, 0
+	}
+
+	return first, second, clampUnit(vec3.Dot(&ac, &ab) / l)
+}
+
+// RasterizeVertical fills img with the gradient, 0% on the bottom row and
+// 100% on the top one.
+func (grad *Gradient) RasterizeVertical(img *image.RGBA, opts RasterOptions) {
+	h := float64(img.Bounds().Dy())
+	rasterizeRows(img, opts, image.Point{}, func(y int) vec3.T {
+		return grad.ExactColor((h - float64(y)) / h)
+	})
+}
+
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
+
+// rasterizeRows fills img with one colour per row, rowColor gets the row
+// relative to the top of img and returns sRGB in the 0..1 range. Colours are
+// computed exactly, so dithering hides the steps of 8 bit or palette output
+// instead of adding to them. origin places img in a larger picture, the
+// dither pattern and pixel blocks line up across images sharing it.
+func rasterizeRows(img *image.RGBA, opts RasterOptions, origin image.Point, rowColor func(y int) vec3.T) {
+	bounds := img.Bounds()
+	ps := opts.PixelSize
+	if ps < 1 {
+		ps = 1
+	}
+
+	var palette []vec3.T
+	for _, c := range opts.Palette {
+		palette = append(palette, paletteUnit(c))
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		by := floorDiv(origin.Y+y-bounds.Min.Y, ps)
+		row := rowColor(by*ps - origin.Y)
+
+		if palette != nil {
+			first, second, t := paletteMix(palette, row)
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				pick := first
+				if opts.Dither != DitherNone && ditherThreshold(opts.Dither, floorDiv(origin.X+x-bounds.Min.X, ps), by) < t {
+					pick = second
+				} else if opts.Dither == DitherNone && t > .5 {
+					pick = second
+				}
+				img.SetRGBA(x, y, toRGBA(palette[pick]))
+			}
+			continue
+		}
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			offset := 0.0
+			if opts.Dither != DitherNone {
+				offset = (ditherThreshold(opts.Dither, floorDiv(origin.X+x-bounds.Min.X, ps), by) - .5) / 255
+			}
+			img.SetRGBA(x, y, toRGBA(vec3.T{row[0] + offset, row[1] + offset, row[2] + offset}))
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/ungerik/go3d/float64/vec2"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// An impact faster than shakeImpact shakes the screen, all it can at
+// shakeImpactMax
+const shakeImpact = 5
+const shakeImpactMax = 250
+
+// shakeMax is how far the screen moves at full trauma, in px, and
+// shakeRecovery how much trauma goes away every second
+const shakeMax = 12
+const shakeRecovery = 1.5
+
+// A pickup flashes the screen, it fades out in flashTime ms
+const flashTime = 250
+const flashAlpha = .6
+
+// The vignette shows under vignetteO2 of o2, the world loses its colour
+// under desaturationO2
+const vignetteO2 = 40
+const desaturationO2 = 50
+const desaturationMin = .15
+
+// The vignette is drawn small and stretched to the screen
+const vignetteWidth = 160
+const vignetteHeight = 120
+
+var vignetteColor = color.NRGBA{0xac, 0x32, 0x32, 0xff}
+var flashColor = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+
+var imgVignette *ebiten.Image
+
+func init() {
+	// clear in the middle, opaque in the corners
+	img := image.NewNRGBA(image.Rect(0, 0, vignetteWidth, vignetteHeight))
+	for y := 0; y < vignetteHeight; y++ {
+		for x := 0; x < vignetteWidth; x++ {
+			dx := (float64(x) + .5 - vignetteWidth/2) / (vignetteWidth / 2)
+			dy := (float64(y) + .5 - vignetteHeight/2) / (vignetteHeight / 2)
+			a := math.Max(0, math.Min(1, (math.Hypot(dx, dy)-.55)/.8))
+			c := vignetteColor
+			c.A = uint8(255 * a * a)
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	var err error
+	imgVignette, err = ebiten.NewImageFromImage(img, ebiten.FilterLinear)
+	if err != nil {
+		Panic("effects", map[string]interface{}{"image": "vignette"}, err)
+	}
+	imageAllocated()
+}
+
+// ScreenEffect is a layer of the effects stack. Transform changes how the
+// world is drawn to the screen, Overlay draws over it. Disabled effects are
+// skipped.
+type ScreenEffect interface {
+	Enabled() bool
+	Update(player *sim.J0hn, delta int64)
+	Transform(op *ebiten.DrawImageOptions)
+	Overlay(screen *ebiten.Image)
+}
+
+// ShakeEffect moves the world around after impacts, harder with more trauma.
+type ShakeEffect struct {
+	trauma float64
+	offset vec2.T
+}
+
+func (s *ShakeEffect) Enabled() bool {
+	return settings.ScreenShake && !settings.ReduceMotion
+}
+
+// Add adds trauma, from 0 to 1.
+func (s *ShakeEffect) Add(trauma float64) {
+	s.trauma = math.Min(1, s.trauma+trauma)
+}
+
+func (s *ShakeEffect) Update(_ *sim.J0hn, delta int64) {
+	s.trauma = math.Max(0, s.trauma-shakeRecovery*float64(delta)/1000)
+
+	// squared, so small knocks stay small
+	amount := shakeMax * s.trauma * s.trauma
+	s.offset = vec2.T{(rand.Float64()*2 - 1) * amount, (rand.Float64()*2 - 1) * amount}
+}
+
+func (s *ShakeEffect) Transform(op *ebiten.DrawImageOptions) {
+	op.GeoM.Translate(math.Round(s.offset[0]), math.Round(s.offset[1]))
+}
+
+func (s *ShakeEffect) Overlay(*ebiten.Image) {}
+
+// FlashEffect whites the screen out for a moment.
+type FlashEffect struct {
+	alpha float64
+}
+
+func (f *FlashEffect) Enabled() bool {
+	return settings.PickupFlash
+}
+
+func (f *FlashEffect) Flash() {
+	f.alpha = flashAlpha
+}
+
+func (f *FlashEffect) Update(_ *sim.J0hn, delta int64) {
+	f.alpha = math.Max(0, f.alpha-flashAlpha*float64(delta)/flashTime)
+}
+
+func (f *FlashEffect) Transform(*ebiten.DrawImageOptions) {}
+
+func (f *FlashEffect) Overlay(screen *ebiten.Image) {
+	if f.alpha <= 0 {
+		return
+	}
+
+	w, h := screen.Size()
+	c := flashColor
+	c.A = uint8(255 * f.alpha)
+	ebitenutil.DrawRect(screen, 0, 0, float64(w), float64(h), c)
+}
+
+// VignetteEffect closes in red around the screen as o2 runs out, pulsing
+// faster the less is left. It holds still with reduced motion.
+type VignetteEffect struct {
+	strength float64
+	clock    float64
+}
+
+func (v *VignetteEffect) Enabled() bool {
+	return settings.LowO2Vignette
+}
+
+func (v *VignetteEffect) Update(player *sim.J0hn, delta int64) {
+	v.strength = clamp01((vignetteO2 - player.O2) / vignetteO2)
+	// from one beat every two seconds to two per second
+	v.clock += float64(delta) / 1000 * (.5 + 1.5*v.strength)
+}
+
+func (v *VignetteEffect) Transform(*ebiten.DrawImageOptions) {}
+
+func (v *VignetteEffect) Overlay(screen *ebiten.Image) {
+	if v.strength <= 0 {
+		return
+	}
+
+	pulse := .75
+	if !settings.ReduceMotion {
+		pulse = .5 + .5*math.Sin(2*math.Pi*v.clock)
+	}
+
+	w, h := screen.Size()
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(w)/vignetteWidth, float64(h)/vignetteHeight)
+	op.ColorM.Scale(1, 1, 1, v.strength*(.6+.4*pulse))
+	_ = screen.DrawImage(imgVignette, op)
+}
+
+// DesaturationEffect drains the colour of the world as o2 runs out.
+type DesaturationEffect struct {
+	saturation float64
+}
+
+func (d *DesaturationEffect) Enabled() bool {
+	return settings.LowO2Desaturation
+}
+
+func (d *DesaturationEffect) Update(player *sim.J0hn, _ int64) {
+	d.saturation = 1 - (1-desaturationMin)*clamp01((desaturationO2-player.O2)/desaturationO2)
+}
+
+func (d *DesaturationEffect) Transform(op *ebiten.DrawImageOptions) {
+	if d.saturation < 1 {
+		op.ColorM.ChangeHSV(0, d.saturation, 1)
+	}
+}
+
+func (d *DesaturationEffect) Overlay(*ebiten.Image) {}
+
+// Effects is the stack of screen effects, applied in order when the world is
+// drawn on the screen. It shakes the screen on the impacts and flashes it on
+// the pickups of the J0hns it watches. The o2 effects follow the player with
+// the least o2.
+type Effects struct {
+	Shake *ShakeEffect
+	Flash *FlashEffect
+	stack []ScreenEffect
+
+	players []*sim.J0hn
+}
+
+func NewEffects() *Effects {
+	e := &Effects{
+		Shake: &ShakeEffect{},
+		Flash: &FlashEffect{},
+	}
+	e.stack = []ScreenEffect{&DesaturationEffect{saturation: 1}, e.Shake, &VignetteEffect{}, e.Flash}
+
+	events.Subscribe(e.handle)
+	return e
+}
+
+// Watch follows the J0hns of a new run.
+func (e *Effects) Watch(players []*sim.J0hn) {
+	e.players = players
+	e.Shake.trauma = 0
+	e.Flash.alpha = 0
+}
+
+func (e *Effects) handle(ev sim.Event) {
+	if !e.watching(ev.Player) {
+		return
+	}
+
+	switch ev.Kind {
+	case sim.EventImpact:
+		if ev.Speed > shakeImpact {
+			e.Shake.Add(math.Min(1, ev.Speed/shakeImpactMax))
+		}
+	case sim.EventPickup:
+		e.Flash.Flash()
+		e.Shake.Add(.2)
+	}
+}
+
+func (e *Effects) watching(player *sim.J0hn) bool {
+	for _, p := range e.players {
+		if p == player {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Effects) Update(delta int64) {
+	neediest := e.players[0]
+	for _, p := range e.players {
+		if p.O2 < neediest.O2 {
+			neediest = p
+		}
+	}
+
+	for _, effect := range e.stack {
+		effect.Update(neediest, delta)
+	}
+}
+
+// Transform applies the enabled effects to the draw of the world.
+func (e *Effects) Transform(op *ebiten.DrawImageOptions) {
+	for _, effect := range e.stack {
+		if effect.Enabled() {
+			effect.Transform(op)
+		}
+	}
+}
+
+// Overlay draws the enabled effects over the world.
+func (e *Effects) Overlay(screen *ebiten.Image) {
+	for _, effect := range e.stack {
+		if effect.Enabled() {
+			effect.Overlay(screen)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"github.com/golang/freetype/truetype"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/text"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"strings"
+)
+
+// uiFont is the name the HUD font is registered under
+const uiFont = "ka1"
+
+type faceKey struct {
+	name string
+	size float64
+}
+
+// FontManager parses every font once and caches its faces by size, faces
+// keep their glyph caches so they must be reused rather than rebuilt.
+type FontManager struct {
+	fonts map[string]*truetype.Font
+	faces map[faceKey]font.Face
+}
+
+var fonts = NewFontManager()
+
+func init() {
+	if err := fonts.Load(uiFont, fontfile); err != nil {
+		uiLog.WithField("font", fontfile).Error(err)
+	}
+}
+
+func NewFontManager() *FontManager {
+	return &FontManager{
+		fonts: make(map[string]*truetype.Font),
+		faces: make(map[faceKey]font.Face),
+	}
+}
+
+// Load parses a TrueType file and registers it as name.
+func (fm *FontManager) Load(name, path string) error {
+	fontBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := truetype.Parse(fontBytes)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	fm.fonts[name] = f
+	for key := range fm.faces {
+		if key.name == name {
+			delete(fm.faces, key)
+		}
+	}
+
+	return nil
+}
+
+// Face returns the face of a registered font at size points. Sizes are
+// rounded to half points to keep the cache small while the HUD scales. An
+// unknown font falls back to a fixed bitmap face so text is never lost.
+func (fm *FontManager) Face(name string, size float64) font.Face {
+	key := faceKey{name, math.Max(1, math.Round(size*2)/2)}
+	if face, ok := fm.faces[key]; ok {
+		return face
+	}
+
+	f, ok := fm.fonts[name]
+	if !ok {
+		return basicfont.Face7x13
+	}
+
+	face := truetype.NewFace(f, &truetype.Options{
+		Size:    key.size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	fm.faces[key] = face
+	return face
+}
+
+// TextMetrics are in pixels, Width is the widest line.
+type TextMetrics struct {
+	Width      int
+	Height     int
+	Ascent     int
+	Descent    int
+	LineHeight int
+}
+
+func MeasureText(face font.Face, s string) TextMetrics {
+	m := face.Metrics()
+	lines := strings.Split(s, "\n")
+	metrics := TextMetrics{
+		Ascent:     m.Ascent.Ceil(),
+		Descent:    m.Descent.Ceil(),
+		LineHeight: m.Height.Ceil(),
+	}
+
+	for _, line := range lines {
+		if w := font.MeasureString(face, line).Ceil(); w > metrics.Width {
+			metrics.Width = w
+		}
+	}
+	metrics.Height = metrics.LineHeight*(len(lines)-1) + metrics.Ascent + metrics.Descent
+
+	return metrics
+}
+
+// WrapText breaks s into lines no wider than maxWidth pixels, breaking on
+// spaces. Words wider than maxWidth get a line of their own.
+func WrapText(face font.Face, s string, maxWidth int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+
+			if line != "" && font.MeasureString(face, candidate).Ceil() > maxWidth {
+				lines = append(lines, line)
+				line = word
+			} else {
+				line = candidate
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+type TextAlign int
+
+const (
+	AlignLeft TextAlign = iota
+	AlignCenter
+	AlignRight
+)
+
+// TextStyle describes how DrawText renders. Outline is a radius in pixels,
+// Shadow an offset; either is skipped when zero.
+type TextStyle struct {
+	Color        color.Color
+	Align        TextAlign
+	Outline      int
+	OutlineColor color.Color
+	Shadow       image.Point
+	ShadowColor  color.Color
+}
+
+// DrawText draws possibly multi-line text, x is where lines start, center or
+// end depending on Align and y is the baseline of the first line.
+func DrawText(dst *ebiten.Image, s string, face font.Face, x, y int, style TextStyle) {
+	lineHeight := face.Metrics().Height.Ceil()
+
+	for i, line := range strings.Split(s, "\n") {
+		lx, ly := x, y+i*lineHeight
+		switch style.Align {
+		case AlignCenter:
+			lx -= font.MeasureString(face, line).Ceil() / 2
+		case AlignRight:
+			lx -= font.MeasureString(face, line).Ceil()
+		}
+
+		if style.Shadow != (image.Point{}) && style.ShadowColor != nil {
+			text.Draw(dst, line, face, lx+style.Shadow.X, ly+style.Shadow.Y, style.ShadowColor)
+		}
+
+		if style.Outline > 0 && style.OutlineColor != nil {
+			r := style.Outline
+			for dy := -r; dy <= r; dy++ {
+				for dx := -r; dx <= r; dx++ {
+					if (dx != 0 || dy != 0) && dx*dx+dy*dy <= r*r+r {
+						text.Draw(dst, line, face, lx+dx, ly+dy, style.OutlineColor)
+					}
+				}
+			}
+		}
+
+		text.Draw(dst, line, face, lx, ly, style.Color)
+	}
+}
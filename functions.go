@@ -5,6 +5,7 @@ import (
 	"github.com/hajimehoshi/ebiten/ebitenutil"
 	log "github.com/sirupsen/logrus"
 	"github.com/ungerik/go3d/float64/vec2"
+	"math"
 )
 
 func Panic(source string, params map[string]interface{}, err error) {
@@ -19,6 +20,7 @@ func loadSprite(spritePath string) *ebiten.Image {
 	if err != nil {
 		Panic("loadSprite", map[string]interface{}{"spritePath": spritePath}, err)
 	}
+	imageAllocated()
 
 	return ebImg
 }
@@ -30,3 +32,7 @@ func copyVector(src vec2.T) vec2.T {
 
 	return vec2.T(dest)
 }
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
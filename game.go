@@ -1,85 +1,534 @@
 package main
 
 import (
+	"0ms2/sim"
+	"errors"
 	"fmt"
 	"github.com/hajimehoshi/ebiten"
 	"github.com/hajimehoshi/ebiten/ebitenutil"
 	"github.com/ungerik/go3d/float64/vec2"
 	"image"
 	"image/color"
+	"math"
+	"math/rand"
+	"net"
 	"time"
 )
 
+// errQuit ends RunGame when the player picks Quit
+var errQuit = errors.New("quit")
+
+// events carries the events of the game, J0hn and the spawners emit on it
+var events = &sim.EventBus{}
+
 type GameEntities interface {
 	Draw(*ebiten.Image)
 	Update(*ebiten.Image, int64)
 }
 
+// DisplayMode is how the game window behaves.
+type DisplayMode int
+
+const (
+	// DisplayFixed keeps a windowWidth×windowHeight window
+	DisplayFixed DisplayMode = iota
+	// DisplayResizable lets the window be resized, the world is scaled to fit
+	// and the HUD laid out again at the new size
+	DisplayResizable
+	DisplayFullscreen
+)
+
+var displayModeNames = []string{"Fixed", "Resizable", "Fullscreen"}
+
+// maxFrameTime is the most real time, in ms, a frame simulates so a hitch
+// doesn't run a burst of ticks
+const maxFrameTime = 100
+
+func (mode DisplayMode) String() string {
+	if mode < 0 || int(mode) >= len(displayModeNames) {
+		return fmt.Sprintf("DisplayMode(%d)", int(mode))
+	}
+	return displayModeNames[mode]
+}
+
 type Game struct {
 	ShowFPS    bool
 	lastUpdate time.Time
 	bgColor    color.Color
 	gameSize   image.Point
-	entities   []GameEntities
-	lastDraw   time.Time
+	// entities are drawn on world, hudEntities straight on the screen
+	entities    []GameEntities
+	hudEntities []GameEntities
+	lastDraw    time.Time
+	world       *ebiten.Image
+	hud         *HUDLayout
+	display     DisplayMode
+
+	// menus is a stack, the simulation stands still while it isn't empty
+	menus      []*Menu
+	running    bool
+	quit       bool
+	players    []*sim.J0hn
+	player     *sim.J0hn
+	camera     *sim.Camera
+	background *Background
+	planets    *sim.PlanetsSpawner
+	powerups   *sim.PowerupsSpawner
+	platform   *Platform
+	// bestAltitude is the highest the player got in the current run
+	bestAltitude float64
+	scores       HighScores
+	debug        *DebugOverlay
+	console      *Console
+	metrics      *Metrics
+	effects      *Effects
+	achievements *Achievements
+	missions     *Missions
+	ghosts       *Ghosts
+	// race is the network race flown, nil offline, server the race server
+	// the game hosts
+	race   *sim.RaceClient
+	server *sim.RaceServer
+
+	// timeScale speeds the simulation up or down, the entities run as many
+	// ticks as the scaled time holds. timeCarry keeps the fraction of a ms it
+	// leaves behind
+	timeScale float64
+	timeCarry float64
+	god       bool
 }
 
 func newGame(bg color.Color, windowSize image.Point) *Game {
 	game := &Game{
-		bgColor:    bg,
-		gameSize:   windowSize,
-		lastUpdate: time.Now(),
+		bgColor:      bg,
+		gameSize:     windowSize,
+		lastUpdate:   time.Now(),
+		hud:          NewHUDLayout(windowSize),
+		debug:        NewDebugOverlay(),
+		timeScale:    1,
+		metrics:      NewMetrics(),
+		effects:      NewEffects(),
+		achievements: NewAchievements(),
+		ghosts:       NewGhosts(),
 	}
+	game.missions = NewMissions(game.hud)
+	// J0hn plays no sound of his own, the game chimes his pickups
+	events.Subscribe(func(e sim.Event) {
+		if e.Kind == sim.EventPickup {
+			playPickup(e.Powerup)
+		}
+	})
+	game.console = NewConsole(game)
+	game.world, _ = ebiten.NewImage(windowSize.X, windowSize.Y, ebiten.FilterNearest)
+	imageAllocated()
+	game.scores = LoadHighScores()
+
+	game.newRun(newRunSeed())
+	game.PushMenu(game.mainMenu())
 
-	playerPosition := vec2.T{
-		(windowWidth - (playerSize * j0hnScale)) / 2,
-		(windowHeight - (playerSize * j0hnScale)) - 77,
+	return game
+}
+
+func newRunSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// newRun puts a fresh J0hn on the platform, every generator of the run is
+// seeded with seed. The run starts when the menus are closed.
+func (g *Game) newRun(seed int64) {
+	if g.background != nil {
+		g.background.Close()
 	}
 
-	player := NewJ0hn().SetPosition(playerPosition)
-	starfield := NewBackgroundSystem(player)
-	planets := NewPlanetSpawner(player)
-	powerups := NewPowerupSpawner(player)
-	ui := NewUi(player)
+	runSeed = seed
+	rand.Seed(runSeed)
+	g.bestAltitude = 0
 
-	platform := NewPlatform(player)
+	// co-op players stand side by side, each reads his own gamepad. A network
+	// race has a J0hn for every pilot, flown by the pilot you are. A loaded
+	// ghost is raced with the physics it flew
+	n, physics, you := playerCount(), settings.Physics, 0
+	race := g.race.Race()
+	if race != nil {
+		n, physics, you = len(race.Pilots), race.Physics, race.You
+	} else if g.ghosts.Loaded != nil {
+		physics = g.ghosts.Loaded.Physics
+	}
+	var players []*sim.J0hn
+	for i := 0; i < n; i++ {
+		players = append(players, sim.NewJ0hn().SetPlayer(i).SetPosition(sim.StandingPosition(i, n)).
+			SetPhysicsMode(physics).SetGodMode(g.god).SetTuning(tuning).
+			SetControls(playerInputs[i]).SetEvents(events))
+	}
+	own := players
+	if race != nil {
+		own = players[you : you+1]
+	}
+	if n == 1 || race != nil {
+		input.SetGamepad(-1)
+	} else {
+		input.SetGamepad(0)
+	}
+
+	camera := sim.NewCamera(players...)
+	starfield := NewBackgroundSystem(camera)
+	ambient := NewAmbient(camera)
+	planets := sim.NewPlanetSpawner(camera).SetSeed(seed).SetTuning(tuning)
+
+	platform := NewPlatform(camera)
 	platform.SetPosition(&vec2.T{(windowWidth - (platformSize * j0hnScale)) / 2, windowHeight - platformSize*3})
+	particles := NewParticles(camera).AttachPlatform(platform)
+	powerups := sim.NewPowerupSpawner(camera).SetSeed(seed).SetTuning(tuning).SetSparkle(particles.Sparkle)
 
-	game.entities = append(game.entities,
+	g.players = players
+	g.player = players[you]
+	g.camera = camera
+	g.background = starfield
+	g.planets = planets
+	g.powerups = powerups
+	g.platform = platform
+	g.effects.Watch(own)
+	g.achievements.Watch(own)
+	if race != nil {
+		// the server keeps the o2 and the fuel, it has no missions to reward
+		g.missions.Watch(nil, planets, seed)
+	} else {
+		g.missions.Watch(players, planets, seed)
+	}
+	g.ghosts.Watch(players, seed)
+	g.debug.Watch(camera, starfield, ambient, planets, powerups, platform, particles)
+	g.entities = []GameEntities{
 		starfield,
-		planets,
-		powerups,
+		ambient,
+		PlanetsView{planets},
+		PowerupsView{powerups},
 		platform,
-		player,
-		ui,
-	)
+		particles,
+		g.ghosts,
+	}
+	g.hudEntities = nil
+	for _, player := range players {
+		g.entities = append(g.entities, J0hnView{player})
+		g.hudEntities = append(g.hudEntities, NewUi(player, g.hud).SetPlayers(n))
+	}
+	// the camera follows the players once they moved
+	g.entities = append(g.entities, CameraView{camera})
+	g.hudEntities = append(g.hudEntities, NewRadar(camera, planets, powerups, g.hud), g.missions)
+	if race != nil {
+		g.entities = watchRace(g.race, players, camera, planets, powerups, g.entities)
+	}
+}
 
-	return game
+// JoinRace flies in the races of the server at addr as name, from its next
+// race on.
+func (g *Game) JoinRace(addr, name string) error {
+	client, err := sim.DialRace(addr, name)
+	if err != nil {
+		return err
+	}
+
+	g.LeaveRace()
+	g.race = client.SetInput(input).SetEvents(events)
+	netLog.WithField("addr", addr).Infoln("joined race server")
+	return nil
+}
+
+// HostRace runs a race server on addr along the game and joins it over
+// loopback.
+func (g *Game) HostRace(addr, name string) error {
+	server, err := sim.NewRaceServer(addr, settings.Physics, tuning)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := server.Serve(); err != nil {
+			netLog.Errorln("race server stopped:", err)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(server.Addr())
+	if err := g.JoinRace(net.JoinHostPort("localhost", port), name); err != nil {
+		_ = server.Close()
+		return err
+	}
+	g.server = server
+	netLog.WithField("addr", server.Addr()).Infoln("hosting race server")
+	return nil
+}
+
+// LeaveRace goes back to flying offline, stopping the server the game
+// hosts.
+func (g *Game) LeaveRace() {
+	if g.race == nil {
+		return
+	}
+
+	_ = g.race.Close()
+	g.race = nil
+	if g.server != nil {
+		_ = g.server.Close()
+		g.server = nil
+	}
+
+	g.endRun()
+	g.newRun(newRunSeed())
+	if len(g.menus) == 0 {
+		g.PushMenu(g.mainMenu())
+	}
+}
+
+// updateRace builds the runs of the races the server starts, they start
+// right away.
+func (g *Game) updateRace() {
+	race, err := g.race.Poll()
+	if err != nil {
+		netLog.Errorln("left the race:", err)
+		g.LeaveRace()
+		return
+	}
+
+	if race != nil {
+		g.endRun()
+		g.newRun(race.Seed)
+		g.startRun()
+	}
+}
+
+// RaceGhost races run from now on instead of the personal best, nil goes
+// back to the best. The waiting run is rebuilt with the seed and the physics
+// of run so it has the same planets and powerups and flies the same.
+func (g *Game) RaceGhost(run *GhostRun) {
+	g.ghosts.Loaded = run
+	seed := newRunSeed()
+	if run != nil {
+		seed = run.Seed
+	}
+
+	running := g.running
+	g.endRun()
+	g.newRun(seed)
+	if running {
+		g.startRun()
+	}
+}
+
+// startRun closes the menus and lets J0hn go.
+func (g *Game) startRun() {
+	g.menus = nil
+	g.running = true
+	// the key that picked Play would lift J0hn off right away
+	latchThrust()
+}
+
+// endRun records the current run in the high scores.
+func (g *Game) endRun() {
+	if !g.running {
+		return
+	}
+
+	g.running = false
+	g.scores.Add(Score{Altitude: g.bestAltitude, Physics: g.player.Physics, Date: time.Now()})
+	events.Emit(sim.Event{Kind: sim.EventRunEnd, Altitude: g.bestAltitude})
+}
+
+// finishRun ends the run under its results, a new run waits behind them.
+// next runs on Continue.
+func (g *Game) finishRun(next func()) {
+	g.endRun()
+	results := g.resultsMenu(next)
+	g.newRun(newRunSeed())
+	g.menus = []*Menu{results}
+}
+
+// outOfO2 is whether every player ran out of o2, which ends the run.
+func (g *Game) outOfO2() bool {
+	for _, p := range g.players {
+		if p.O2 > 0 {
+			return false
+		}
+	}
+	return len(g.players) > 0
+}
+
+func (g *Game) PushMenu(m *Menu) {
+	g.menus = append(g.menus, m)
+}
+
+func (g *Game) PopMenu() {
+	if len(g.menus) > 0 {
+		g.menus = g.menus[:len(g.menus)-1]
+	}
+}
+
+// Pause freezes the run under the pause menu.
+func (g *Game) Pause() {
+	if g.running && len(g.menus) == 0 {
+		g.PushMenu(g.pauseMenu())
+	}
+}
+
+func (g *Game) Resume() {
+	g.menus = nil
+	latchThrust()
+}
+
+// SetGodMode keeps the players' o2 and fuel from running out, in this run
+// and the next ones.
+func (g *Game) SetGodMode(on bool) {
+	g.god = on
+	for _, p := range g.players {
+		p.SetGodMode(on)
+	}
+}
+
+// Teleport moves the camera to position, in km, and the players with it,
+// scrolling the sky and the platform as if they had flown there.
+func (g *Game) Teleport(position vec2.T) {
+	last := *g.camera.RelativePosition
+	offset := position
+	offset.Sub(&last)
+	for _, p := range g.players {
+		p.RelativePosition.Add(&offset)
+		p.Flying = true
+		p.IsLifting = false
+	}
+	g.camera.Reset()
+	for _, p := range g.players {
+		*p.Position = *p.UpPosition
+	}
+
+	offset = *g.camera.RelativePosition
+	offset.Sub(&last)
+	offset.Scale(pixelsPerKm)
+
+	platformOffset := offset
+	platformOffset.Scale(1 / j0hnScale)
+	g.platform.position.Add(&platformOffset)
+	g.background.Shift(offset)
+}
+
+// Quit saves the run and stops the game after this update.
+func (g *Game) Quit() {
+	g.endRun()
+	g.quit = true
+}
+
+// SetDisplayMode switches the window between fixed, resizable and fullscreen.
+func (g *Game) SetDisplayMode(mode DisplayMode) {
+	g.display = mode
+	ebiten.SetWindowResizable(mode == DisplayResizable)
+	ebiten.SetFullscreen(mode == DisplayFullscreen)
 }
 
 func (g *Game) Update(screen *ebiten.Image) error {
-	d := time.Since(g.lastUpdate).Milliseconds()
+	for _, in := range playerInputs {
+		in.Update()
+	}
+	g.metrics.HandleKeys()
+	if g.race != nil {
+		g.updateRace()
+	}
 
-	for _, e := range g.entities {
-		e.Update(screen, d)
+	simulating := false
+	if g.console.Update() {
+		// so does the console
+	} else if g.debug.Update() {
+		// the inspector freezes the run like a menu
+	} else if len(g.menus) > 0 {
+		g.menus[len(g.menus)-1].Update()
+
+		// no time passes under a menu, the HUD only follows the screen size
+		for _, e := range g.hudEntities {
+			g.metrics.Update(e, screen, 0)
+		}
+	} else if input.JustPressed(ActionPause) {
+		g.Pause()
+	} else {
+		simulating = true
+		frame := math.Min(float64(time.Since(g.lastUpdate))/float64(time.Millisecond), maxFrameTime)
+		elapsed := frame*g.timeScale + g.timeCarry
+		d := int64(elapsed)
+		g.timeCarry = elapsed - float64(d)
+
+		for _, e := range g.entities {
+			g.metrics.Update(e, g.world, d)
+		}
+
+		for _, e := range g.hudEntities {
+			g.metrics.Update(e, screen, d)
+		}
+
+		g.effects.Update(d)
+		g.achievements.Update(d)
+		for _, p := range g.players {
+			g.bestAltitude = math.Max(g.bestAltitude, p.RelativePosition[1])
+		}
+		// races end on the server
+		if g.race == nil && g.running && g.outOfO2() {
+			g.finishRun(g.startRun)
+		}
 	}
+	sounds.Update(flights(g.players), g.running, simulating)
 
 	g.lastUpdate = time.Now()
+	if g.quit {
+		return errQuit
+	}
 	return nil
 }
 
 func (g *Game) Draw(screen *ebiten.Image) {
-	_ = screen.Fill(g.bgColor)
+	_ = g.world.Fill(g.bgColor)
 
 	for _, e := range g.entities {
-		e.Draw(screen)
+		g.metrics.Draw(e, g.world)
 	}
+	g.debug.DrawWorld(g.world)
+
+	// the world is scaled to fit the screen, centered between black bars
+	sw, sh := screen.Size()
+	scale := math.Min(float64(sw)/float64(g.gameSize.X), float64(sh)/float64(g.gameSize.Y))
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate((float64(sw)-float64(g.gameSize.X)*scale)/2, (float64(sh)-float64(g.gameSize.Y)*scale)/2)
+	g.effects.Transform(op)
+	_ = screen.DrawImage(g.world, op)
+	g.effects.Overlay(screen)
+
+	if g.running {
+		for _, e := range g.hudEntities {
+			g.metrics.Draw(e, screen)
+		}
+		g.ghosts.DrawDelta(screen, g.hud)
+	}
+	if g.race != nil {
+		drawStandings(screen, g.race, g.hud)
+	}
+
+	if len(g.menus) > 0 {
+		g.menus[len(g.menus)-1].Draw(screen, g.hud)
+	}
+	g.achievements.DrawToasts(screen, g.hud)
+	g.debug.DrawScreen(screen)
+	g.metrics.DrawGraph(screen)
+	g.console.Draw(screen)
 
 	if g.ShowFPS {
 		_ = ebitenutil.DebugPrint(screen, fmt.Sprintf("TPS: %0.2f\nFPS: %0.2f", ebiten.CurrentTPS(), ebiten.CurrentFPS()))
 	}
+
+	g.metrics.EndFrame(g)
 }
 
-func (g *Game) Layout(int, int) (int, int) {
-	return windowWidth, windowHeight
+// Layout keeps the screen at the game size in DisplayFixed, otherwise the
+// screen gets every device pixel of the window so the HUD stays crisp.
+func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
+	size := g.gameSize
+	if g.display != DisplayFixed && outsideWidth > 0 && outsideHeight > 0 {
+		f := ebiten.DeviceScaleFactor()
+		size = image.Point{int(float64(outsideWidth) * f), int(float64(outsideHeight) * f)}
+	}
+
+	g.hud.Resize(size)
+	return size.X, size.Y
 }
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"0ms2/sim"
+	"encoding/json"
+	"fmt"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/ungerik/go3d/float64/vec2"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ghostVersion is the format of the ghost files, files of another version
+// are refused
+const ghostVersion = 1
+
+// ghostBestFile keeps the best run of each physics mode
+const ghostBestFile = "ghost-%s.json"
+
+// J0hn is sampled every ghostSampleTime ms of flight, the ghost moves
+// smoothly between samples
+const ghostSampleTime = 100
+
+var ghostTint = [4]float64{.6, .8, 1, .45}
+var ghostBehindColor = color.RGBA{0xac, 0x32, 0x32, 0xFF}
+
+// GhostSample is where J0hn was T ms after launching. X and Y are his
+// position in km, OX and OY how his sprite was shifted by tilting, R its
+// rotation and F its animation frame.
+type GhostSample struct {
+	T  int64   `json:"t"`
+	X  float64 `json:"x"`
+	Y  float64 `json:"y"`
+	OX float64 `json:"ox"`
+	OY float64 `json:"oy"`
+	R  float64 `json:"r"`
+	F  int     `json:"f"`
+}
+
+// GhostRun is a recorded run, what ghost files hold. Seed is the run seed, a
+// run against the ghost spawns the same planets and powerups at the same time
+// after launch, where J0hn moves them is up to him.
+type GhostRun struct {
+	Version  int             `json:"version"`
+	Seed     int64           `json:"seed"`
+	Physics  sim.PhysicsMode `json:"physics"`
+	Altitude float64         `json:"altitude"`
+	Date     time.Time       `json:"date"`
+	Samples  []GhostSample   `json:"samples"`
+}
+
+// LoadGhost reads a ghost file saved by GhostRun.Save.
+func LoadGhost(path string) (*GhostRun, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &GhostRun{}
+	if err := json.Unmarshal(data, run); err != nil {
+		return nil, err
+	}
+	if err := run.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return run, nil
+}
+
+func (r *GhostRun) validate() error {
+	if r.Version != ghostVersion {
+		return fmt.Errorf("ghost version %d, expected %d", r.Version, ghostVersion)
+	}
+	if r.Physics != sim.PhysicsArcade && r.Physics != sim.PhysicsAtmospheric {
+		return fmt.Errorf("ghost physics %d unknown", int(r.Physics))
+	}
+	if len(r.Samples) == 0 {
+		return fmt.Errorf("ghost has no samples")
+	}
+	if !sort.SliceIsSorted(r.Samples, func(i, j int) bool { return r.Samples[i].T < r.Samples[j].T }) {
+		return fmt.Errorf("ghost samples out of order")
+	}
+
+	return nil
+}
+
+// Save writes the run to a ghost file anyone can load.
+func (r *GhostRun) Save(path string) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// At is where the ghost is t ms after launching. It stays at its last sample
+// once the run is over.
+func (r *GhostRun) At(t int64) GhostSample {
+	i := sort.Search(len(r.Samples), func(i int) bool { return r.Samples[i].T >= t })
+	if i == 0 {
+		return r.Samples[0]
+	}
+	if i == len(r.Samples) {
+		return r.Samples[i-1]
+	}
+
+	a, b := r.Samples[i-1], r.Samples[i]
+	f := float64(t-a.T) / float64(b.T-a.T)
+	a.X += (b.X - a.X) * f
+	a.Y += (b.Y - a.Y) * f
+	return a
+}
+
+func bestGhostFile(physics sim.PhysicsMode) string {
+	return fmt.Sprintf(ghostBestFile, strings.ToLower(physics.String()))
+}
+
+// Ghosts records every run and races it against a ghost: the file loaded to
+// race, or the personal best of the physics mode. A run beating the best
+// becomes the new best. Co-op runs race player 1 against the ghost but
+// aren't recorded, the other players change how he flies.
+type Ghosts struct {
+	// Loaded is raced instead of the personal best while set
+	Loaded *GhostRun
+
+	best      map[sim.PhysicsMode]*GhostRun
+	player    *sim.J0hn
+	recording *GhostRun
+	ghost     *GhostRun
+	// clock is the ms since launch, -1 before
+	clock  int64
+	sample GhostSample
+}
+
+func NewGhosts() *Ghosts {
+	g := &Ghosts{best: make(map[sim.PhysicsMode]*GhostRun)}
+	events.Subscribe(g.handle)
+	return g
+}
+
+// Best is the personal best of physics, nil when there's none.
+func (g *Ghosts) Best(physics sim.PhysicsMode) *GhostRun {
+	if run, ok := g.best[physics]; ok {
+		return run
+	}
+
+	file := bestGhostFile(physics)
+	run := &GhostRun{}
+	if err := loadConfig(file, run); err != nil {
+		progressLog.WithField("file", file).Warnln("can't load best ghost:", err)
+		run = nil
+	} else if run.validate() != nil {
+		// no best yet
+		run = nil
+	}
+
+	g.best[physics] = run
+	return run
+}
+
+// Ghost is what the current run races, nil when there's nothing to race.
+func (g *Ghosts) Ghost() *GhostRun {
+	return g.ghost
+}
+
+// Watch records the J0hns of a new run, seeded with seed.
+func (g *Ghosts) Watch(players []*sim.J0hn, seed int64) {
+	player := players[0]
+	g.player = player
+	g.recording = nil
+	if len(players) == 1 {
+		g.recording = &GhostRun{
+			Version: ghostVersion,
+			Seed:    seed,
+			Physics: player.Physics,
+		}
+	}
+	g.clock = -1
+
+	g.ghost = g.Loaded
+	if g.ghost == nil {
+		g.ghost = g.Best(player.Physics)
+	}
+}
+
+func (g *Ghosts) handle(e sim.Event) {
+	switch e.Kind {
+	case sim.EventLaunch:
+		// J0hn keeps lifting off until he is flying
+		if g.clock < 0 && e.Player == g.player {
+			g.clock = 0
+			g.record()
+		}
+	case sim.EventRunEnd:
+		g.finish(e.Altitude)
+	}
+}
+
+// finish keeps the run as the best when it got higher than the best.
+func (g *Ghosts) finish(altitude float64) {
+	run := g.recording
+	if run == nil || len(run.Samples) == 0 {
+		return
+	}
+	g.recording = nil
+
+	if best := g.Best(run.Physics); best != nil && best.Altitude >= altitude {
+		return
+	}
+
+	run.Altitude = altitude
+	run.Date = time.Now()
+	g.best[run.Physics] = run
+
+	file := bestGhostFile(run.Physics)
+	if err := saveConfig(file, run); err != nil {
+		progressLog.WithField("file", file).Errorln("can't save best ghost:", err)
+	}
+}
+
+func (g *Ghosts) record() {
+	if g.recording == nil {
+		return
+	}
+
+	p := g.player
+	g.recording.Samples = append(g.recording.Samples, GhostSample{
+		T:  g.clock,
+		X:  p.RelativePosition[0],
+		Y:  p.RelativePosition[1],
+		OX: p.Position[0] - p.UpPosition[0],
+		OY: p.Position[1] - p.UpPosition[1],
+		R:  p.Rotation,
+		F:  p.AnimationFrame,
+	})
+}
+
+func (g *Ghosts) Update(_ *ebiten.Image, delta int64) {
+	if g.clock < 0 {
+		return
+	}
+
+	last := g.clock / ghostSampleTime
+	g.clock += delta
+	if g.clock/ghostSampleTime != last {
+		g.record()
+	}
+
+	if g.ghost != nil {
+		g.sample = g.ghost.At(g.clock)
+	}
+}
+
+// Delta is how many km J0hn is above the ghost, false when there's no ghost
+// flying.
+func (g *Ghosts) Delta() (float64, bool) {
+	if g.ghost == nil || g.clock < 0 {
+		return 0, false
+	}
+	return g.player.RelativePosition[1] - g.sample.Y, true
+}
+
+// Draw puts a translucent J0hn where the ghost is, the world scrolls the same
+// for both so the ghost is off J0hn by the km between them.
+func (g *Ghosts) Draw(screen *ebiten.Image) {
+	if !settings.ShowGhost || g.ghost == nil || g.clock < 0 {
+		return
+	}
+
+	p := g.player
+	offset := vec2.T{p.RelativePosition[0] - g.sample.X, p.RelativePosition[1] - g.sample.Y}
+	offset.Scale(pixelsPerKm / j0hnScale)
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Rotate(g.sample.R)
+	op.GeoM.Translate(p.UpPosition[0]+offset[0]+g.sample.OX, p.UpPosition[1]+offset[1]+g.sample.OY)
+	op.GeoM.Scale(j0hnScale, j0hnScale)
+	op.ColorM.Scale(ghostTint[0], ghostTint[1], ghostTint[2], ghostTint[3])
+
+	x := g.sample.F * playerSize
+	_ = screen.DrawImage(imgJ0hn.SubImage(image.Rect(x, 0, x+playerSize, playerSize)).(*ebiten.Image), op)
+}
+
+// DrawDelta shows how far ahead or behind the ghost J0hn is.
+func (g *Ghosts) DrawDelta(screen *ebiten.Image, layout *HUDLayout) {
+	delta, ok := g.Delta()
+	if !ok || !settings.ShowGhost {
+		return
+	}
+
+	sign, c := "+", missionDoneColor
+	if delta < 0 {
+		sign, c = "-", ghostBehindColor
+	}
+
+	scale := layout.Scale() * settings.TextScale
+	pos := layout.Place(AnchorBottomCenter, vec2.T{0, 20}, vec2.T{})
+	DrawText(screen, T("ghost.delta", sign+FormatDistance(math.Abs(delta))), fonts.Face(uiFont, 20*scale),
+		int(pos[0]), int(pos[1]), TextStyle{
+			Color:        c,
+			Align:        AlignCenter,
+			Outline:      int(math.Max(1, math.Round(scale))),
+			OutlineColor: uiOutlineColor,
+		})
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ungerik/go3d/float64/vec3"
+	"golang.org/x/image/colornames"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var cssColorSpaces = map[string]ColorSpace{
+	"srgb":        SpaceSRGB,
+	"srgb-linear": SpaceLinearRGB,
+	"hsl":         SpaceHSL,
+	"oklab":       SpaceOKLab,
+}
+
+// ParseCSSGradient reads a CSS like gradient:
+//
+//	linear-gradient(to top in oklab, white, #cbdbff 30%, 40%, rgb(99, 155, 255) 50% 80%, black)
+//
+// Stops take #rgb, #rrggbb, rgb() or named colours with up to two percent
+// positions, a bare percentage is a colour hint. Angles and directions are
+// accepted but ignored, positions always run along the 0..1 axis of Gradient.
+func ParseCSSGradient(src string) (*Gradient, error) {
+	src = strings.TrimSpace(src)
+	if !strings.HasPrefix(src, "linear-gradient(") || !strings.HasSuffix(src, ")") {
+		return nil, fmt.Errorf("gradient %q: expected linear-gradient(...)", src)
+	}
+
+	args := splitTopLevel(src[len("linear-gradient(") : len(src)-1])
+	grad := NewGradient(SpaceSRGB)
+
+	if len(args) > 0 {
+		if _, _, err := splitCSSColor(args[0]); err != nil {
+			space, err := parseGradientLine(args[0])
+			if err != nil {
+				return nil, err
+			}
+			grad.space = space
+			args = args[1:]
+		}
+	}
+
+	type cssStop struct {
+		color    *vec3.T
+		position float64
+		hint     float64
+	}
+	stops := []cssStop{}
+	unset := math.NaN()
+
+	for _, arg := range args {
+		if arg == "" {
+			return nil, fmt.Errorf("gradient %q: empty argument", src)
+		}
+
+		if p, err := parsePercent(arg); err == nil {
+			if len(stops) == 0 || !math.IsNaN(stops[len(stops)-1].hint) {
+				return nil, fmt.Errorf("gradient %q: misplaced colour hint %q", src, arg)
+			}
+			stops[len(stops)-1].hint = p
+			continue
+		}
+
+		c, rest, err := splitCSSColor(arg)
+		if err != nil {
+			return nil, fmt.Errorf("gradient %q: %v", src, err)
+		}
+
+		positions := strings.Fields(rest)
+		if len(positions) > 2 {
+			return nil, fmt.Errorf("gradient %q: too many positions in %q", src, arg)
+		}
+
+		if len(positions) == 0 {
+			stops = append(stops, cssStop{color: c, position: unset, hint: unset})
+		}
+		for _, pos := range positions {
+			p, err := parsePercent(pos)
+			if err != nil {
+				return nil, fmt.Errorf("gradient %q: %v", src, err)
+			}
+			stops = append(stops, cssStop{color: c, position: p, hint: unset})
+		}
+	}
+
+	if len(stops) < 2 {
+		return nil, fmt.Errorf("gradient %q: needs at least two colour stops", src)
+	}
+
+	// missing positions follow the CSS rules: ends default to 0 and 1, the
+	// rest are spread evenly and no stop may go back before a previous one
+	if math.IsNaN(stops[0].position) {
+		stops[0].position = 0
+	}
+	if math.IsNaN(stops[len(stops)-1].position) {
+		stops[len(stops)-1].position = 1
+	}
+	for i := 1; i < len(stops); i++ {
+		if math.IsNaN(stops[i].position) {
+			j := i
+			for math.IsNaN(stops[j].position) {
+				j++
+			}
+			step := (stops[j].position - stops[i-1].position) / float64(j-i+1)
+			for k := i; k < j; k++ {
+				stops[k].position = stops[i-1].position + step*float64(k-i+1)
+			}
+		}
+		if stops[i].position < stops[i-1].position {
+			stops[i].position = stops[i-1].position
+		}
+	}
+
+	for i, s := range stops {
+		easing := EaseLinear
+		if !math.IsNaN(s.hint) && i+1 < len(stops) {
+			if d := stops[i+1].position - s.position; d > 0 {
+				easing = EaseMidpoint((s.hint - s.position) / d)
+			}
+		}
+		grad.AddEasedColor(s.position, s.color, easing)
+	}
+
+	return grad, nil
+}
+
+// parseGradientLine reads the optional first argument, only its colour space
+// matters.
+func parseGradientLine(arg string) (ColorSpace, error) {
+	fields := strings.Fields(arg)
+	space := SpaceSRGB
+
+	for i := 0; i < len(fields); i++ {
+		switch {
+		case fields[i] == "in":
+			if i+1 >= len(fields) {
+				return space, fmt.Errorf("gradient line %q: missing colour space", arg)
+			}
+			s, ok := cssColorSpaces[fields[i+1]]
+			if !ok {
+				return space, fmt.Errorf("gradient line %q: unknown colour space %q", arg, fields[i+1])
+			}
+			space = s
+			i++
+		case fields[i] == "to":
+			// direction keywords follow
+		case fields[i] == "top", fields[i] == "bottom", fields[i] == "left", fields[i] == "right":
+		case strings.HasSuffix(fields[i], "deg"), strings.HasSuffix(fields[i], "turn"), strings.HasSuffix(fields[i], "rad"):
+		default:
+			return space, fmt.Errorf("gradient line %q: unexpected %q", arg, fields[i])
+		}
+	}
+
+	return space, nil
+}
+
+// splitTopLevel splits on commas that aren't inside parentheses.
+func splitTopLevel(s string) []string {
+	var out []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				out = append(out, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	return append(out, strings.TrimSpace(s[start:]))
+}
+
+func parsePercent(s string) (float64, error) {
+	if !strings.HasSuffix(s, "%") {
+		return 0, fmt.Errorf("%q is not a percentage", s)
+	}
+
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a percentage", s)
+	}
+
+	return v / 100, nil
+}
+
+// splitCSSColor parses the colour at the start of a stop, returning whatever
+// follows it.
+func splitCSSColor(s string) (*vec3.T, string, error) {
+	s = strings.TrimSpace(s)
+	lower := strings.ToLower(s)
+
+	switch {
+	case strings.HasPrefix(lower, "rgb(") || strings.HasPrefix(lower, "rgba("):
+		end := strings.Index(s, ")")
+		if end < 0 {
+			return nil, "", fmt.Errorf("unclosed colour %q", s)
+		}
+		inner := s[strings.Index(s, "(")+1 : end]
+		parts := strings.FieldsFunc(inner, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '/'
+		})
+		if len(parts) < 3 {
+			return nil, "", fmt.Errorf("bad colour %q", s[:end+1])
+		}
+		c := vec3.T{}
+		for i := 0; i < 3; i++ {
+			v, err := strconv.ParseFloat(parts[i], 64)
+			if err != nil {
+				return nil, "", fmt.Errorf("bad colour %q", s[:end+1])
+			}
+			c[i] = v
+		}
+		return &c, s[end+1:], nil
+
+	case strings.HasPrefix(s, "#"):
+		word := strings.Fields(s)[0]
+		hex := word[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) != 6 {
+			return nil, "", fmt.Errorf("bad colour %q", word)
+		}
+		return &vec3.T{float64(v >> 16 & 0xFF), float64(v >> 8 & 0xFF), float64(v & 0xFF)}, s[len(word):], nil
+
+	default:
+		words := strings.Fields(lower)
+		if len(words) == 0 {
+			return nil, "", fmt.Errorf("missing colour")
+		}
+		word := words[0]
+		named, ok := colornames.Map[word]
+		if !ok {
+			return nil, "", fmt.Errorf("unknown colour %q", word)
+		}
+		return &vec3.T{float64(named.R), float64(named.G), float64(named.B)}, s[len(word):], nil
+	}
+}
+
+// ggrEasing maps a GIMP segment blending function around its midpoint m.
+func ggrEasing(blend int, m float64) (Easing, error) {
+	if m <= 0 {
+		m = 1e-6
+	} else if m >= 1 {
+		m = 1 - 1e-6
+	}
+
+	linear := func(t float64) float64 {
+		if t <= m {
+			return .5 * t / m
+		}
+		return .5 + .5*(t-m)/(1-m)
+	}
+
+	switch blend {
+	case 0:
+		return linear, nil
+	case 1:
+		return EaseMidpoint(m), nil
+	case 2:
+		return func(t float64) float64 {
+			return (math.Sin(-math.Pi/2+math.Pi*linear(t)) + 1) / 2
+		}, nil
+	case 3:
+		return func(t float64) float64 {
+			t = linear(t) - 1
+			return math.Sqrt(1 - t*t)
+		}, nil
+	case 4:
+		return func(t float64) float64 {
+			t = linear(t)
+			return 1 - math.Sqrt(1-t*t)
+		}, nil
+	case 5:
+		return func(t float64) float64 {
+			if t < m {
+				return 0
+			}
+			return 1
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown blending function %d", blend)
+}
+
+// ParseGGR reads a GIMP gradient. Alpha is ignored and segments blended in
+// HSV switch the whole gradient to HSL.
+func ParseGGR(r io.Reader) (*Gradient, error) {
+	scanner := bufio.NewScanner(r)
+	var lines []string
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 || lines[0] != "GIMP Gradient" {
+		return nil, fmt.Errorf("ggr: missing GIMP Gradient header")
+	}
+	lines = lines[1:]
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "Name:") {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("ggr: missing segment count")
+	}
+
+	count, err := strconv.Atoi(lines[0])
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("ggr: bad segment count %q", lines[0])
+	}
+	if len(lines)-1 < count {
+		return nil, fmt.Errorf("ggr: expected %d segments, got %d", count, len(lines)-1)
+	}
+
+	grad := NewGradient(SpaceSRGB)
+	for i, line := range lines[1 : count+1] {
+		fields := strings.Fields(line)
+		if len(fields) < 13 {
+			return nil, fmt.Errorf("ggr: segment %d: expected 13 fields, got %d", i, len(fields))
+		}
+
+		v := make([]float64, 11)
+		for j := range v {
+			if v[j], err = strconv.ParseFloat(fields[j], 64); err != nil {
+				return nil, fmt.Errorf("ggr: segment %d: %v", i, err)
+			}
+		}
+		blend, err1 := strconv.Atoi(fields[11])
+		colorType, err2 := strconv.Atoi(fields[12])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("ggr: segment %d: bad blending or colour type", i)
+		}
+
+		left, mid, right := v[0], v[1], v[2]
+		m := .5
+		if right > left {
+			m = (mid - left) / (right - left)
+		}
+		easing, err := ggrEasing(blend, m)
+		if err != nil {
+			return nil, fmt.Errorf("ggr: segment %d: %v", i, err)
+		}
+		if colorType == 1 || colorType == 2 {
+			grad.space = SpaceHSL
+		}
+
+		grad.AddEasedColor(left, &vec3.T{v[3] * 255, v[4] * 255, v[5] * 255}, easing)
+		grad.AddColor(right, &vec3.T{v[7] * 255, v[8] * 255, v[9] * 255})
+	}
+
+	return grad, nil
+}
+
+func LoadGGR(path string) (*Gradient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseGGR(f)
+}
@@ -3,60 +3,349 @@ package main
 import (
 	"github.com/ungerik/go3d/float64/vec3"
 	"image/color"
+	"math"
 	"sort"
 )
 
+// gradientLUTSize is the resolution of the lookup table used by GetColor.
+const gradientLUTSize = 1024
+
+// ColorSpace selects where colours are blended between two stops.
+type ColorSpace int
+
+const (
+	// SpaceSRGB blends the raw sRGB values, the way the sky used to be drawn
+	SpaceSRGB ColorSpace = iota
+	SpaceLinearRGB
+	SpaceHSL
+	SpaceOKLab
+)
+
+// Easing remaps the position between two stops, both ends must map to
+// themselves: f(0) = 0 and f(1) = 1.
+type Easing func(float64) float64
+
+func EaseLinear(t float64) float64 {
+	return t
+}
+
+func EaseIn(t float64) float64 {
+	return t * t
+}
+
+func EaseOut(t float64) float64 {
+	return 1 - (1-t)*(1-t)
+}
+
+func EaseInOut(t float64) float64 {
+	return smoothStep(t)
+}
+
+// EaseStep holds the colour of the first stop for the whole segment.
+func EaseStep(t float64) float64 {
+	if t >= 1 {
+		return 1
+	}
+	return 0
+}
+
+// EaseMidpoint moves the halfway colour to position m, bending the curve the
+// same way CSS colour hints and GIMP curved segments do.
+func EaseMidpoint(m float64) Easing {
+	if m <= 0 || m >= 1 || m == .5 {
+		return EaseLinear
+	}
+
+	exp := math.Log(.5) / math.Log(m)
+	return func(t float64) float64 {
+		return math.Pow(t, exp)
+	}
+}
+
 type GradientColor struct {
 	percentPosition float64
 	color           *vec3.T
+	// easing shapes the segment going from this stop to the next one
+	easing Easing
+}
+
+// Gradient maps a position in [0, 1] to a colour. Stops are kept sorted and
+// GetColor reads from a lookup table, both rebuilt only when stops change.
+type Gradient struct {
+	stops []GradientColor
+	space ColorSpace
+	lut   []color.RGBA
+	dirty bool
+}
+
+func NewGradient(space ColorSpace) *Gradient {
+	return &Gradient{
+		space: space,
+		dirty: true,
+	}
 }
 
-type Gradient []GradientColor
+// AddColor adds a stop with a linear segment after it. c holds sRGB values in
+// the 0..255 range.
+func (grad *Gradient) AddColor(position float64, c *vec3.T) *Gradient {
+	return grad.AddEasedColor(position, c, EaseLinear)
+}
+
+// AddEasedColor adds a stop whose segment towards the next stop is shaped by
+// easing.
+func (grad *Gradient) AddEasedColor(position float64, c *vec3.T, easing Easing) *Gradient {
+	if easing == nil {
+		easing = EaseLinear
+	}
 
-func (grad *Gradient) AddColor(position float64, c *vec3.T) {
-	*grad = append(*grad, GradientColor{
+	grad.stops = append(grad.stops, GradientColor{
 		percentPosition: position,
 		color:           c,
+		easing:          easing,
 	})
+	grad.dirty = true
+	return grad
 }
 
-func (grad *Gradient) GetColor(percent float64) color.Color {
-	g := *grad
-	sort.Slice(g, func(i, j int) bool {
-		a := g[i]
-		b := g[j]
-		return a.percentPosition < b.percentPosition
+func (grad *Gradient) SetColorSpace(space ColorSpace) *Gradient {
+	grad.space = space
+	grad.dirty = true
+	return grad
+}
+
+func (grad *Gradient) ColorSpace() ColorSpace {
+	return grad.space
+}
+
+func (grad *Gradient) prepare() {
+	if !grad.dirty {
+		return
+	}
+
+	// stable, so stops sharing a position keep their order and make a hard edge
+	sort.SliceStable(grad.stops, func(i, j int) bool {
+		return grad.stops[i].percentPosition < grad.stops[j].percentPosition
 	})
 
-	grad = &g
+	if grad.lut == nil {
+		grad.lut = make([]color.RGBA, gradientLUTSize)
+	}
+	for i := range grad.lut {
+		grad.lut[i] = toRGBA(grad.sample(float64(i) / (gradientLUTSize - 1)))
+	}
 
-	lastColor := GradientColor{}
-	for _, c := range *grad {
-		if c.percentPosition < percent {
-			lastColor = c
-			continue
-		}
+	grad.dirty = false
+}
 
-		o := vec3.T{c.color[0], c.color[1], c.color[2]}
-		o.Sub(lastColor.color)
-		p := percent - lastColor.percentPosition
-		d := c.percentPosition - lastColor.percentPosition
-		o.Scale(p / d)
-		o.Add(lastColor.color)
-
-		return color.RGBA{
-			uint8(o[0]),
-			uint8(o[1]),
-			uint8(o[2]),
-			255,
-		}
+// sample computes the exact colour at percent, as sRGB in the 0..1 range.
+func (grad *Gradient) sample(percent float64) vec3.T {
+	stops := grad.stops
+	if len(stops) == 0 {
+		return vec3.T{1, 1, 1}
+	}
+
+	if percent <= stops[0].percentPosition {
+		return srgbUnit(stops[0].color)
+	}
+
+	last := stops[len(stops)-1]
+	if percent >= last.percentPosition {
+		return srgbUnit(last.color)
+	}
+
+	// first stop past percent, the segment is [i-1, i]
+	i := sort.Search(len(stops), func(i int) bool {
+		return stops[i].percentPosition > percent
+	})
+	from, to := stops[i-1], stops[i]
+
+	d := to.percentPosition - from.percentPosition
+	if d <= 0 {
+		return srgbUnit(to.color)
+	}
+
+	t := from.easing((percent - from.percentPosition) / d)
+	return mixColors(grad.space, srgbUnit(from.color), srgbUnit(to.color), t)
+}
+
+// GetColor returns the colour at percent from the lookup table.
+func (grad *Gradient) GetColor(percent float64) color.Color {
+	return grad.RGBAAt(percent)
+}
+
+// RGBAAt is GetColor without the interface allocation, for per pixel loops.
+func (grad *Gradient) RGBAAt(percent float64) color.RGBA {
+	grad.prepare()
+
+	if math.IsNaN(percent) || percent <= 0 {
+		return grad.lut[0]
+	} else if percent >= 1 {
+		return grad.lut[gradientLUTSize-1]
+	}
+
+	return grad.lut[int(percent*(gradientLUTSize-1)+.5)]
+}
+
+// ExactColor skips the lookup table, returning sRGB in the 0..1 range.
+func (grad *Gradient) ExactColor(percent float64) vec3.T {
+	grad.prepare()
+	return grad.sample(percent)
+}
+
+func srgbUnit(c *vec3.T) vec3.T {
+	return vec3.T{c[0] / 255, c[1] / 255, c[2] / 255}
+}
+
+func clampUnit(v float64) float64 {
+	if v < 0 {
+		return 0
+	} else if v > 1 {
+		return 1
 	}
-	g = *grad
+	return v
+}
 
+func toRGBA(c vec3.T) color.RGBA {
 	return color.RGBA{
-		R: 255,
-		G: 255,
-		B: 255,
-		A: 255,
+		uint8(clampUnit(c[0])*255 + .5),
+		uint8(clampUnit(c[1])*255 + .5),
+		uint8(clampUnit(c[2])*255 + .5),
+		255,
+	}
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+// mixColors blends two sRGB colours (0..1) in space.
+func mixColors(space ColorSpace, a, b vec3.T, t float64) vec3.T {
+	switch space {
+	case SpaceLinearRGB:
+		la, lb := srgbToLinear(a), srgbToLinear(b)
+		return linearToSRGB(vec3.T{lerp(la[0], lb[0], t), lerp(la[1], lb[1], t), lerp(la[2], lb[2], t)})
+	case SpaceHSL:
+		ha, hb := srgbToHSL(a), srgbToHSL(b)
+		// greys have no hue, borrow the other end's so they don't swing around
+		if ha[1] == 0 {
+			ha[0] = hb[0]
+		} else if hb[1] == 0 {
+			hb[0] = ha[0]
+		}
+		dh := hb[0] - ha[0]
+		if dh > .5 {
+			dh--
+		} else if dh < -.5 {
+			dh++
+		}
+		h := math.Mod(ha[0]+dh*t+1, 1)
+		return hslToSRGB(vec3.T{h, lerp(ha[1], hb[1], t), lerp(ha[2], hb[2], t)})
+	case SpaceOKLab:
+		oa, ob := linearToOKLab(srgbToLinear(a)), linearToOKLab(srgbToLinear(b))
+		return linearToSRGB(okLabToLinear(vec3.T{lerp(oa[0], ob[0], t), lerp(oa[1], ob[1], t), lerp(oa[2], ob[2], t)}))
+	default:
+		return vec3.T{lerp(a[0], b[0], t), lerp(a[1], b[1], t), lerp(a[2], b[2], t)}
+	}
+}
+
+func srgbChannelToLinear(v float64) float64 {
+	if v <= .04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+.055)/1.055, 2.4)
+}
+
+func linearChannelToSRGB(v float64) float64 {
+	if v <= .0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - .055
+}
+
+func srgbToLinear(c vec3.T) vec3.T {
+	return vec3.T{srgbChannelToLinear(c[0]), srgbChannelToLinear(c[1]), srgbChannelToLinear(c[2])}
+}
+
+func linearToSRGB(c vec3.T) vec3.T {
+	return vec3.T{
+		linearChannelToSRGB(clampUnit(c[0])),
+		linearChannelToSRGB(clampUnit(c[1])),
+		linearChannelToSRGB(clampUnit(c[2])),
+	}
+}
+
+// OKLab conversions, from https://bottosson.github.io/posts/oklab/
+func linearToOKLab(c vec3.T) vec3.T {
+	l := math.Cbrt(.4122214708*c[0] + .5363325363*c[1] + .0514459929*c[2])
+	m := math.Cbrt(.2119034982*c[0] + .6806995451*c[1] + .1073969566*c[2])
+	s := math.Cbrt(.0883024619*c[0] + .2817188376*c[1] + .6299787005*c[2])
+
+	return vec3.T{
+		.2104542553*l + .7936177850*m - .0040720468*s,
+		1.9779984951*l - 2.4285922050*m + .4505937099*s,
+		.0259040371*l + .7827717662*m - .8086757660*s,
+	}
+}
+
+func okLabToLinear(c vec3.T) vec3.T {
+	l := c[0] + .3963377774*c[1] + .2158037573*c[2]
+	m := c[0] - .1055613458*c[1] - .0638541728*c[2]
+	s := c[0] - .0894841775*c[1] - 1.2914855480*c[2]
+	l, m, s = l*l*l, m*m*m, s*s*s
+
+	return vec3.T{
+		4.0767416621*l - 3.3077115913*m + .2309699292*s,
+		-1.2684380046*l + 2.6097574011*m - .3413193965*s,
+		-.0041960863*l - .7034186147*m + 1.7076147010*s,
+	}
+}
+
+// srgbToHSL returns hue, saturation and lightness, all in the 0..1 range.
+func srgbToHSL(c vec3.T) vec3.T {
+	max := math.Max(c[0], math.Max(c[1], c[2]))
+	min := math.Min(c[0], math.Min(c[1], c[2]))
+	l := (max + min) / 2
+	if max == min {
+		return vec3.T{0, 0, l}
+	}
+
+	d := max - min
+	s := d / (1 - math.Abs(2*l-1))
+
+	var h float64
+	switch max {
+	case c[0]:
+		h = math.Mod((c[1]-c[2])/d+6, 6)
+	case c[1]:
+		h = (c[2]-c[0])/d + 2
+	default:
+		h = (c[0]-c[1])/d + 4
 	}
+
+	return vec3.T{h / 6, s, l}
+}
+
+func hslToSRGB(c vec3.T) vec3.T {
+	chroma := (1 - math.Abs(2*c[2]-1)) * c[1]
+	h := c[0] * 6
+	x := chroma * (1 - math.Abs(math.Mod(h, 2)-1))
+	m := c[2] - chroma/2
+
+	var r, g, b float64
+	switch {
+	case h < 1:
+		r, g, b = chroma, x, 0
+	case h < 2:
+		r, g, b = x, chroma, 0
+	case h < 3:
+		r, g, b = 0, chroma, x
+	case h < 4:
+		r, g, b = 0, x, chroma
+	case h < 5:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+
+	return vec3.T{r + m, g + m, b + m}
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"github.com/ungerik/go3d/float64/vec2"
+	"image"
+	"math"
+)
+
+// Anchor is the point of the screen a HUD widget is placed from.
+type Anchor int
+
+const (
+	AnchorTopLeft Anchor = iota
+	AnchorTopCenter
+	AnchorTopRight
+	AnchorCenterLeft
+	AnchorCenter
+	AnchorCenterRight
+	AnchorBottomLeft
+	AnchorBottomCenter
+	AnchorBottomRight
+)
+
+// Margins are in HUD design units, see HUDLayout.
+type Margins struct {
+	Top, Right, Bottom, Left float64
+}
+
+// HUDLayout places HUD widgets on a screen of any size. Offsets and margins
+// are given in design units, pixels of the windowWidth×windowHeight screen the
+// HUD was drawn for, and scaled with the screen. Offsets point inwards, away
+// from the anchor's edges.
+type HUDLayout struct {
+	screen   image.Point
+	scale    float64
+	safeArea Margins
+}
+
+func NewHUDLayout(screen image.Point) *HUDLayout {
+	l := &HUDLayout{
+		safeArea: Margins{uiMarginLeft, uiMarginLeft, uiMarginLeft, uiMarginLeft},
+	}
+	l.Resize(screen)
+
+	return l
+}
+
+// Resize recomputes the scale for a new screen size, in pixels.
+func (l *HUDLayout) Resize(screen image.Point) {
+	l.screen = screen
+	l.scale = math.Min(float64(screen.X)/windowWidth, float64(screen.Y)/windowHeight)
+	if l.scale <= 0 {
+		l.scale = 1
+	}
+}
+
+func (l *HUDLayout) SetSafeArea(margins Margins) *HUDLayout {
+	l.safeArea = margins
+	return l
+}
+
+func (l *HUDLayout) Screen() image.Point {
+	return l.screen
+}
+
+// Scale is the size of a design unit in screen pixels.
+func (l *HUDLayout) Scale() float64 {
+	return l.scale
+}
+
+// PixelScale rounds base×Scale to a whole number, sprites drawn with it keep
+// every pixel the same size.
+func (l *HUDLayout) PixelScale(base float64) float64 {
+	return math.Max(1, math.Round(base*l.scale))
+}
+
+// Place returns the screen position of the top-left corner of a widget of
+// size (in screen pixels) placed at offset (in design units) from anchor.
+func (l *HUDLayout) Place(anchor Anchor, offset, size vec2.T) vec2.T {
+	min := vec2.T{l.safeArea.Left * l.scale, l.safeArea.Top * l.scale}
+	max := vec2.T{
+		float64(l.screen.X) - l.safeArea.Right*l.scale,
+		float64(l.screen.Y) - l.safeArea.Bottom*l.scale,
+	}
+
+	place := func(column int, axis int) float64 {
+		switch column {
+		case 0:
+			return min[axis] + offset[axis]*l.scale
+		case 1:
+			return (min[axis]+max[axis]-size[axis])/2 + offset[axis]*l.scale
+		default:
+			return max[axis] - size[axis] - offset[axis]*l.scale
+		}
+	}
+
+	return vec2.T{
+		math.Round(place(int(anchor)%3, 0)),
+		math.Round(place(int(anchor)/3, 1)),
+	}
+}
+
+// World returns the screen position of a point of the world image, which is
+// scaled to fit the screen and centered, see Game.Draw.
+func (l *HUDLayout) World(p vec2.T) vec2.T {
+	return vec2.T{
+		(float64(l.screen.X)-windowWidth*l.scale)/2 + p[0]*l.scale,
+		(float64(l.screen.Y)-windowHeight*l.scale)/2 + p[1]*l.scale,
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const localesPath = "locales"
+
+// referenceLanguage is the complete catalog, the others are checked against
+// it and fall back to it
+const referenceLanguage = "en"
+
+// formatKey holds the number and date formats of a locale file
+const formatKey = "_format"
+
+// kmPerMile converts distances for UnitsImperial
+const kmPerMile = 1.609344
+
+// UnitSystem is how distances are shown.
+type UnitSystem int
+
+const (
+	UnitsMetric UnitSystem = iota
+	UnitsImperial
+)
+
+// pluralForm picks the form of a message for a count, by language. Languages
+// not listed use English rules.
+var pluralForms = map[string]func(n int) string{
+	"en": func(n int) string {
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	},
+	"es": func(n int) string {
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	},
+}
+
+// LocaleFormat is how numbers and dates are written in a language.
+type LocaleFormat struct {
+	Decimal   string `json:"decimal"`
+	Thousands string `json:"thousands"`
+	Date      string `json:"date"`
+}
+
+// Catalog holds the messages of a language. A message is either a string or
+// an object of plural forms, both are fmt format strings.
+type Catalog struct {
+	Language string
+	Format   LocaleFormat
+	messages map[string]map[string]string
+}
+
+var catalogs = make(map[string]*Catalog)
+var catalog *Catalog
+
+// reportedKeys keeps a missing key from being logged on every frame
+var reportedKeys = make(map[string]bool)
+
+func init() {
+	files, err := filepath.Glob(filepath.Join(localesPath, "*.json"))
+	if err != nil {
+		Panic("i18n", map[string]interface{}{"path": localesPath}, err)
+	}
+
+	for _, file := range files {
+		c, err := LoadCatalog(file)
+		if err != nil {
+			uiLog.WithField("file", file).Error(err)
+			continue
+		}
+		catalogs[c.Language] = c
+	}
+
+	for lang, keys := range MissingKeys() {
+		uiLog.WithFields(log.Fields{"language": lang, "keys": keys}).Warnln("missing translations")
+	}
+
+	SetLanguage(referenceLanguage)
+}
+
+// LoadCatalog reads a locale file, the language is the file name.
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	c := &Catalog{
+		Language: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Format:   LocaleFormat{Decimal: ".", Thousands: ",", Date: "2006-01-02"},
+		messages: make(map[string]map[string]string),
+	}
+
+	for key, value := range raw {
+		if key == formatKey {
+			err = json.Unmarshal(value, &c.Format)
+		} else if len(value) > 0 && value[0] == '{' {
+			forms := make(map[string]string)
+			err = json.Unmarshal(value, &forms)
+			c.messages[key] = forms
+		} else {
+			var s string
+			err = json.Unmarshal(value, &s)
+			c.messages[key] = map[string]string{"other": s}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, key, err)
+		}
+	}
+
+	return c, nil
+}
+
+// SetLanguage switches the catalog, an unknown language keeps the current one.
+func SetLanguage(lang string) {
+	if c, ok := catalogs[lang]; ok {
+		catalog = c
+	} else {
+		uiLog.WithField("language", lang).Warnln("unknown language")
+	}
+}
+
+// Languages returns the loaded languages, sorted.
+func Languages() []string {
+	var langs []string
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	return langs
+}
+
+// lookup finds a plural form of key in the current catalog, then in the
+// reference one. Missing keys are shown as is.
+func lookup(key, form string) string {
+	for _, c := range []*Catalog{catalog, catalogs[referenceLanguage]} {
+		if c == nil {
+			continue
+		}
+
+		if forms, ok := c.messages[key]; ok {
+			if s, ok := forms[form]; ok {
+				return s
+			}
+			return forms["other"]
+		}
+	}
+
+	if !reportedKeys[key] {
+		reportedKeys[key] = true
+		uiLog.WithField("key", key).Warnln("untranslated message")
+	}
+	return key
+}
+
+func language() string {
+	if catalog == nil {
+		return referenceLanguage
+	}
+	return catalog.Language
+}
+
+// T translates key, args fill the message as in fmt.Sprintf.
+func T(key string, args ...interface{}) string {
+	msg := lookup(key, "other")
+	if len(args) == 0 {
+		return msg
+	}
+
+	return fmt.Sprintf(msg, args...)
+}
+
+// TN translates key in the plural form for n, args fill the message.
+func TN(key string, n int, args ...interface{}) string {
+	plural, ok := pluralForms[language()]
+	if !ok {
+		plural = pluralForms[referenceLanguage]
+	}
+
+	return fmt.Sprintf(lookup(key, plural(n)), args...)
+}
+
+// MissingKeys returns, by language, the keys of the reference catalog a
+// catalog lacks. Languages with every key are left out.
+func MissingKeys() map[string][]string {
+	missing := make(map[string][]string)
+	ref, ok := catalogs[referenceLanguage]
+	if !ok {
+		return missing
+	}
+
+	for lang, c := range catalogs {
+		for key, forms := range ref.messages {
+			if _, ok := c.messages[key]; !ok {
+				missing[lang] = append(missing[lang], key)
+				continue
+			}
+
+			for form := range forms {
+				if _, ok := c.messages[key][form]; !ok {
+					missing[lang] = append(missing[lang], key+"."+form)
+				}
+			}
+		}
+		sort.Strings(missing[lang])
+	}
+
+	for lang, keys := range missing {
+		if len(keys) == 0 {
+			delete(missing, lang)
+		}
+	}
+
+	return missing
+}
+
+func currentFormat() LocaleFormat {
+	if catalog == nil {
+		return LocaleFormat{Decimal: ".", Thousands: ",", Date: "2006-01-02"}
+	}
+	return catalog.Format
+}
+
+// FormatNumber writes v with decimals digits after the separator, grouping
+// thousands as the language does.
+func FormatNumber(v float64, decimals int) string {
+	format := currentFormat()
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	sign := ""
+	// -0 is only a rounding artifact
+	if negative && strings.Trim(s, "0.") != "" {
+		sign = "-"
+	}
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteString(format.Thousands)
+		}
+		grouped.WriteRune(digit)
+	}
+
+	if frac != "" {
+		return sign + grouped.String() + format.Decimal + frac
+	}
+	return sign + grouped.String()
+}
+
+// FormatDistance writes a distance given in km in the units of the settings,
+// rounded to a whole number.
+func FormatDistance(km float64) string {
+	if settings.Units == UnitsImperial {
+		return T("unit.mi", FormatNumber(math.Round(km/kmPerMile), 0))
+	}
+
+	return T("unit.km", FormatNumber(math.Round(km), 0))
+}
+
+// CheckLocales prints the missing keys of every language, it returns false
+// when some are missing.
+func CheckLocales(w io.Writer) bool {
+	missing := MissingKeys()
+	for _, lang := range Languages() {
+		keys, ok := missing[lang]
+		if !ok {
+			fmt.Fprintf(w, "%s: complete\n", lang)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %d missing\n", lang, len(keys))
+		for _, key := range keys {
+			fmt.Fprintf(w, "  %s\n", key)
+		}
+	}
+
+	return len(missing) == 0
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"strings"
+)
+
+// Action is something the player does, bound to keys and gamepad buttons.
+type Action int
+
+const (
+	ActionThrust Action = iota
+	ActionLeft
+	ActionRight
+	ActionPause
+	ActionUp
+	ActionDown
+	ActionConfirm
+	ActionBack
+	actionCount
+)
+
+var actionNames = [actionCount]string{"Thrust", "Left", "Right", "Pause", "Up", "Down", "Confirm", "Back"}
+
+func (a Action) String() string {
+	return actionNames[a]
+}
+
+// gamepadDeadZone is how far a stick must be pushed to count as a direction
+const gamepadDeadZone = .5
+
+// Gamepads have no standard layout in this ebiten version, these buttons are
+// where most XInput pads put A, B and Start.
+var gamepadBindings = map[Action][]ebiten.GamepadButton{
+	ActionThrust:  {ebiten.GamepadButton0},
+	ActionConfirm: {ebiten.GamepadButton0},
+	ActionBack:    {ebiten.GamepadButton1},
+	ActionPause:   {ebiten.GamepadButton7},
+}
+
+// stickActions are the actions a stick or d-pad axis can trigger, by axis
+// and sign.
+var stickActions = map[Action]struct {
+	axis int
+	sign float64
+}{
+	ActionLeft:  {0, -1},
+	ActionRight: {0, 1},
+	ActionUp:    {1, -1},
+	ActionDown:  {1, 1},
+}
+
+// Input maps keyboard and gamepad state to actions. Only the key bindings
+// can be changed, they are saved with the settings. Every co-op player has
+// one, player is from 0 and picks the default keys.
+type Input struct {
+	player int
+	// gamepad is which connected gamepad is read, -1 reads them all
+	gamepad int
+	keys    map[Action][]ebiten.Key
+	// held remembers which stick actions were on last frame, sticks have no
+	// just pressed state of their own
+	held     [actionCount]bool
+	justHeld [actionCount]bool
+	latched  [actionCount]bool
+}
+
+var input = NewInput()
+
+func NewInput() *Input {
+	return NewPlayerInput(0).SetGamepad(-1)
+}
+
+// NewPlayerInput reads the keys of a co-op player and its own gamepad.
+func NewPlayerInput(player int) *Input {
+	in := &Input{player: player, gamepad: player}
+	in.ResetBindings()
+	return in
+}
+
+// SetGamepad makes the input read only the index-th connected gamepad, or
+// every gamepad with -1.
+func (in *Input) SetGamepad(index int) *Input {
+	in.gamepad = index
+	return in
+}
+
+// gamepads are the IDs of the gamepads the input reads.
+func (in *Input) gamepads() []int {
+	ids := ebiten.GamepadIDs()
+	if in.gamepad < 0 {
+		return ids
+	}
+	if in.gamepad < len(ids) {
+		return ids[in.gamepad : in.gamepad+1]
+	}
+	return nil
+}
+
+// ResetBindings restores the default keys.
+func (in *Input) ResetBindings() {
+	if in.player > 0 {
+		in.keys = map[Action][]ebiten.Key{}
+		for action, keys := range coopBindings[in.player-1] {
+			in.keys[action] = append([]ebiten.Key(nil), keys...)
+		}
+		return
+	}
+
+	in.keys = map[Action][]ebiten.Key{
+		ActionThrust:  {ebiten.KeySpace},
+		ActionLeft:    {ebiten.KeyLeft},
+		ActionRight:   {ebiten.KeyRight},
+		ActionPause:   {ebiten.KeyEscape, ebiten.KeyP},
+		ActionUp:      {ebiten.KeyUp},
+		ActionDown:    {ebiten.KeyDown},
+		ActionConfirm: {ebiten.KeyEnter, ebiten.KeySpace},
+		ActionBack:    {ebiten.KeyEscape, ebiten.KeyBackspace},
+	}
+}
+
+// Bind makes key the only key of action, the ones bound before stop working.
+func (in *Input) Bind(action Action, key ebiten.Key) {
+	in.keys[action] = []ebiten.Key{key}
+}
+
+// Keys returns the keys bound to action, the main one first.
+func (in *Input) Keys(action Action) []ebiten.Key {
+	return in.keys[action]
+}
+
+// Update must be called once per frame, before actions are read.
+func (in *Input) Update() {
+	for action, stick := range stickActions {
+		on := false
+		for _, id := range in.gamepads() {
+			if ebiten.GamepadAxisNum(id) > stick.axis && ebiten.GamepadAxis(id, stick.axis)*stick.sign > gamepadDeadZone {
+				on = true
+			}
+		}
+		in.justHeld[action] = on && !in.held[action]
+		in.held[action] = on
+	}
+
+	for action := Action(0); action < actionCount; action++ {
+		if in.latched[action] && !in.down(action) {
+			in.latched[action] = false
+		}
+	}
+}
+
+// Latch ignores action until it is released, so the key that closed a menu
+// doesn't also act in the game.
+func (in *Input) Latch(action Action) {
+	in.latched[action] = in.down(action)
+}
+
+// Pressed reports whether action is held down.
+func (in *Input) Pressed(action Action) bool {
+	return !in.latched[action] && in.down(action)
+}
+
+// Held is what the flight actions hold down, the input flies J0hn.
+func (in *Input) Held() sim.Keys {
+	return sim.Keys{
+		Thrust: in.Pressed(ActionThrust),
+		Left:   in.Pressed(ActionLeft),
+		Right:  in.Pressed(ActionRight),
+	}
+}
+
+func (in *Input) down(action Action) bool {
+	for _, key := range in.keys[action] {
+		if ebiten.IsKeyPressed(key) {
+			return true
+		}
+	}
+
+	for _, id := range in.gamepads() {
+		for _, button := range gamepadBindings[action] {
+			if ebiten.IsGamepadButtonPressed(id, button) {
+				return true
+			}
+		}
+	}
+
+	return in.held[action]
+}
+
+// JustPressed reports whether action started on this frame.
+func (in *Input) JustPressed(action Action) bool {
+	for _, key := range in.keys[action] {
+		if inpututil.IsKeyJustPressed(key) {
+			return true
+		}
+	}
+
+	for _, id := range in.gamepads() {
+		for _, button := range gamepadBindings[action] {
+			if inpututil.IsGamepadButtonJustPressed(id, button) {
+				return true
+			}
+		}
+	}
+
+	return in.justHeld[action]
+}
+
+// JustPressedKey returns a key pressed on this frame, for rebinding.
+func JustPressedKey() (ebiten.Key, bool) {
+	for k := ebiten.Key(0); k <= ebiten.KeyMax; k++ {
+		if inpututil.IsKeyJustPressed(k) {
+			return k, true
+		}
+	}
+
+	return 0, false
+}
+
+// KeyByName is the inverse of ebiten.Key.String, for loading bindings.
+func KeyByName(name string) (ebiten.Key, bool) {
+	for k := ebiten.Key(0); k <= ebiten.KeyMax; k++ {
+		if strings.EqualFold(k.String(), name) {
+			return k, true
+		}
+	}
+
+	return 0, false
+}
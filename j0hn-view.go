@@ -0,0 +1,54 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+	"image"
+	"path/filepath"
+)
+
+var imgJ0hn *ebiten.Image
+
+func init() {
+	imgJ0hn = loadSprite(filepath.Join(spritesPath, j0hnSpriteFile))
+}
+
+// J0hnView runs a J0hn in the game loop and draws him, tinted for the co-op
+// players after the first.
+type J0hnView struct {
+	*sim.J0hn
+}
+
+func (v J0hnView) Update(_ *ebiten.Image, delta int64) {
+	v.J0hn.Update(delta)
+}
+
+func (v J0hnView) Draw(screen *ebiten.Image) {
+	j0hn := v.J0hn
+	op := ebiten.DrawImageOptions{}
+	//op.GeoM.Rotate(1)
+	op.GeoM.Rotate(j0hn.Rotation)
+	op.GeoM.Translate(float64(j0hn.Position[0]), float64(j0hn.Position[1]))
+	op.GeoM.Scale(j0hnScale, j0hnScale)
+	if j0hn.Index > 0 {
+		tint := playerTints[j0hn.Index]
+		op.ColorM.Scale(tint[0], tint[1], tint[2], 1)
+	}
+
+	x1, y1 := j0hn.AnimationFrame*playerSize, 0
+	x2, y2 := x1+playerSize, y1+playerSize
+
+	_ = screen.DrawImage(imgJ0hn.SubImage(image.Rect(x1, y1, x2, y2)).(*ebiten.Image), &op)
+	/*ebitenutil.DebugPrintAt(
+		screen,
+		fmt.Sprintf(
+			"Fuel: %0.2f\nO2: %0.2f\nVelocity:\n  x: %0.2f\n  y: %0.2f",
+			j0hn.fuel,
+			j0hn.o2,
+			j0hn.velocity[0],
+			j0hn.velocity[1],
+		),
+		0,
+		windowHeight/2,
+	)*/
+}
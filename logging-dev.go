@@ -0,0 +1,8 @@
+//go:build !release
+// +build !release
+
+package main
+
+// defaultLogLevel is the log level of development builds, build with
+// -tags release to silence logging by default
+const defaultLogLevel = "info"
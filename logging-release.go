@@ -0,0 +1,8 @@
+//go:build release
+// +build release
+
+package main
+
+// defaultLogLevel keeps release builds quiet unless the logging config or
+// the flags say otherwise
+const defaultLogLevel = logOff
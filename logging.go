@@ -0,0 +1,250 @@
+package main
+
+import (
+	"0ms2/mixer"
+	"0ms2/sim"
+	"flag"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+const loggingFile = "logging.json"
+
+// logOff is the level that silences a subsystem, logrus has none
+const logOff = "off"
+
+// gameSubsystem logs through the standard logrus logger, for everything
+// without a subsystem of its own
+const gameSubsystem = "game"
+
+// LogConfig sets up logging. Levels are logrus level names or "off", a
+// subsystem without a level of its own uses Level. MaxSizeMB rotates File
+// once it grows past it, 0 never rotates.
+type LogConfig struct {
+	Level      string            `json:"level"`
+	Subsystems map[string]string `json:"subsystems"`
+	Format     string            `json:"format"`
+	File       string            `json:"file"`
+	MaxSizeMB  int               `json:"maxSizeMB"`
+	MaxBackups int               `json:"maxBackups"`
+}
+
+// loggers are the loggers of every subsystem, so they can be set up again
+// once the config is read
+var loggers = map[string]*log.Logger{gameSubsystem: log.StandardLogger()}
+
+var playerLog = newSubsystemLogger("player")
+var backgroundLog = newSubsystemLogger("background")
+var planetsLog = newSubsystemLogger("planets")
+var powerupsLog = newSubsystemLogger("powerups")
+var uiLog = newSubsystemLogger("ui")
+var audioLog = newSubsystemLogger("audio")
+var netLog = newSubsystemLogger("net")
+
+// progressLog is for what the player keeps between runs: achievements,
+// missions and ghosts
+var progressLog = newSubsystemLogger("progress")
+
+func init() {
+	setLogLevel(log.StandardLogger(), defaultLogLevel)
+
+	// the simulation and the mixer log under the same subsystems as the game
+	sim.PlayerLog, sim.PlanetsLog, sim.PowerupsLog, sim.NetLog = playerLog, planetsLog, powerupsLog, netLog
+	mixer.Log = audioLog
+}
+
+func newSubsystemLogger(name string) *log.Entry {
+	logger := log.New()
+	setLogLevel(logger, defaultLogLevel)
+	loggers[name] = logger
+
+	return logger.WithField("subsystem", name)
+}
+
+func DefaultLogConfig() *LogConfig {
+	return &LogConfig{
+		Level:      defaultLogLevel,
+		Subsystems: make(map[string]string),
+		Format:     "text",
+		MaxSizeMB:  10,
+		MaxBackups: 3,
+	}
+}
+
+// LoadLogConfig reads the logging config file, the flags registered by
+// LogFlags override it once parsed.
+func LoadLogConfig() *LogConfig {
+	cfg := DefaultLogConfig()
+	if err := loadConfig(loggingFile, cfg); err != nil {
+		log.WithField("file", loggingFile).Warnln("can't load logging config:", err)
+		return DefaultLogConfig()
+	}
+
+	if cfg.Subsystems == nil {
+		cfg.Subsystems = make(map[string]string)
+	}
+
+	return cfg
+}
+
+// subsystemLevels is a flag value like "player=trace,ui=off".
+type subsystemLevels map[string]string
+
+func (l subsystemLevels) String() string {
+	var pairs []string
+	for name, level := range l {
+		pairs = append(pairs, name+"="+level)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l subsystemLevels) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("expected subsystem=level, got %q", pair)
+		}
+		l[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return nil
+}
+
+// LogFlags registers the logging flags on the default flag set, they write
+// straight into cfg.
+func LogFlags(cfg *LogConfig) {
+	flag.StringVar(&cfg.Level, "log-level", cfg.Level, "default log level: trace, debug, info, warning, error or off")
+	flag.Var(subsystemLevels(cfg.Subsystems), "log", "log levels by subsystem, e.g. player=trace,powerups=off")
+	flag.StringVar(&cfg.Format, "log-format", cfg.Format, "log format: text or json")
+	flag.StringVar(&cfg.File, "log-file", cfg.File, "write the log to a file instead of stderr")
+}
+
+func setLogLevel(logger *log.Logger, level string) error {
+	if level == logOff {
+		logger.SetLevel(log.PanicLevel)
+		logger.SetOutput(ioutil.Discard)
+		return nil
+	}
+
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(lvl)
+	return nil
+}
+
+// ConfigureLogging sets every subsystem logger up after cfg.
+func ConfigureLogging(cfg *LogConfig) error {
+	var out io.Writer = os.Stderr
+	if cfg.File != "" {
+		f, err := NewRotatingFile(cfg.File, int64(cfg.MaxSizeMB)*1024*1024, cfg.MaxBackups)
+		if err != nil {
+			return err
+		}
+		out = f
+	}
+
+	var formatter log.Formatter = &log.TextFormatter{}
+	switch cfg.Format {
+	case "json":
+		formatter = &log.JSONFormatter{}
+	case "text", "":
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	for name := range cfg.Subsystems {
+		if _, ok := loggers[name]; !ok {
+			return fmt.Errorf("unknown log subsystem %q", name)
+		}
+	}
+
+	for name, logger := range loggers {
+		level := cfg.Level
+		if l, ok := cfg.Subsystems[name]; ok {
+			level = l
+		}
+
+		logger.SetFormatter(formatter)
+		logger.SetOutput(out)
+		if err := setLogLevel(logger, level); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// RotatingFile is a log file that is renamed to path.1 once it reaches
+// maxSize bytes, path.1 to path.2 and so on up to maxBackups.
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	rf.file = f
+	rf.size = info.Size()
+	return nil
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	for i := rf.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+	}
+	if rf.maxBackups > 0 {
+		_ = os.Rename(rf.path, rf.path+".1")
+	} else {
+		_ = os.Remove(rf.path)
+	}
+
+	return rf.open()
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxSize > 0 && rf.size+int64(len(p)) > rf.maxSize && rf.size > 0 {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
@@ -2,30 +2,94 @@ package main
 
 import "C"
 import (
+	"0ms2/mixer"
+	"0ms2/sim"
+	"flag"
 	"github.com/hajimehoshi/ebiten"
 	_ "github.com/silbinarywolf/preferdiscretegpu"
 	log "github.com/sirupsen/logrus"
 	"image"
 	"image/color"
-	"math/rand"
-	"time"
+	"os"
 )
 
 var game *Game
 
+// runSeed drives every procedural generator of the current run
+var runSeed int64
+
 func init() {
-	// init random seed
-	rand.Seed(time.Now().UnixNano())
-	game = newGame(color.Black, image.Point{windowWidth, windowHeight})
-	game.ShowFPS = true
-	log.SetLevel(log.DebugLevel)
+	settings = LoadSettings()
 }
 
 func main() {
+	checkLocales := flag.Bool("check-locales", false, "report missing translations and exit")
+	debug := flag.Bool("debug", false, "start with the debug overlay on, F3 toggles it")
+	renderMusic := flag.String("render-music", "", "render the flight music along a climb to space to a WAV file and exit")
+	renderSeconds := flag.Float64("render-seconds", 180, "length of the music rendered by -render-music")
+	mute := flag.Bool("mute", false, "play no sound at all")
+	ghost := flag.String("ghost", "", "race the ghost saved in a file, see the ghost console command")
+	join := flag.String("join", "", "race on the race server at an address")
+	host := flag.String("host", "", "race on a race server run along the game, on an address")
+	name := flag.String("name", sim.DefaultPilotName, "who you race as")
+	script := flag.String("exec", "", "console script to run at start, "+consoleScript+" from the config folder by default")
+	logConfig := LoadLogConfig()
+	LogFlags(logConfig)
+	flag.Parse()
+
+	if err := ConfigureLogging(logConfig); err != nil {
+		log.Fatal(err)
+	}
+	if *checkLocales {
+		if !CheckLocales(os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+	if *renderMusic != "" {
+		if err := mixer.RenderMusic(*renderMusic, *renderSeconds, newRunSeed()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if !*mute {
+		backend, err := NewEbitenAudioBackend()
+		if err != nil {
+			audioLog.Errorln("no sound:", err)
+		} else {
+			sounds = newSounds(backend)
+		}
+	}
+
+	// built here rather than in init, so every sprite is loaded by now. Every
+	// run seeds the random generators, see Game.newRun
+	game = newGame(color.Black, image.Point{windowWidth, windowHeight})
+	game.debug.Enabled = *debug
+	if *ghost != "" {
+		run, err := LoadGhost(*ghost)
+		if err != nil {
+			log.WithField("file", *ghost).Errorln("can't load ghost:", err)
+		} else {
+			game.RaceGhost(run)
+		}
+	}
+	if *host != "" {
+		if err := game.HostRace(*host, *name); err != nil {
+			netLog.WithField("addr", *host).Errorln("can't host race:", err)
+		}
+	} else if *join != "" {
+		if err := game.JoinRace(*join, *name); err != nil {
+			netLog.WithField("addr", *join).Errorln("can't join race:", err)
+		}
+	}
+	game.console.RunStartupScript(*script)
+
 	ebiten.SetWindowSize(windowWidth, windowHeight)
 	ebiten.SetWindowTitle(gameTitle)
+	settings.Apply()
 
-	if err := ebiten.RunGame(game); err != nil {
+	if err := ebiten.RunGame(game); err != nil && err != errQuit {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/ungerik/go3d/float64/vec2"
+	"golang.org/x/image/colornames"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+var menuTextColor = color.RGBA{0xcb, 0xdb, 0xfc, 0xFF}
+var menuSelectedColor = color.RGBA{0xfb, 0xf2, 0x36, 0xFF}
+var menuDisabledColor = color.RGBA{0x84, 0x7e, 0x87, 0xFF}
+var menuDimColor = color.NRGBA{0x00, 0x00, 0x00, 0xA0}
+
+// MenuItem is a line of a menu, Label is a message key. Items without Activate, Adjust or Bind are
+// just text and can't be selected.
+type MenuItem struct {
+	Label string
+	// Value is shown after the label, for settings
+	Value    func() string
+	Activate func()
+	// Adjust is called with -1 or 1 when left or right is pressed
+	Adjust func(dir int)
+	// Bind makes the item wait for a key press when activated
+	Bind func(ebiten.Key)
+	// Hint is shown under the menu while the item is selected, items with
+	// one can be selected to read it
+	Hint func() string
+}
+
+func (item *MenuItem) selectable() bool {
+	return item.Activate != nil || item.Adjust != nil || item.Bind != nil || item.Hint != nil
+}
+
+// Menu is a vertical list of items navigated with the menu actions.
+type Menu struct {
+	// Title is a message key
+	Title string
+	Items []*MenuItem
+	// OnBack runs when the back action is pressed, nil ignores it
+	OnBack func()
+
+	selected  int
+	capturing bool
+}
+
+func NewMenu(title string, items ...*MenuItem) *Menu {
+	m := &Menu{Title: title, Items: items}
+	m.move(0)
+	return m
+}
+
+func (m *Menu) SetOnBack(onBack func()) *Menu {
+	m.OnBack = onBack
+	return m
+}
+
+// move selects the next selectable item in dir, wrapping around. With dir 0
+// it keeps the current item if it can be selected.
+func (m *Menu) move(dir int) {
+	step := dir
+	if step == 0 {
+		step = 1
+	}
+
+	i := m.selected
+	if dir != 0 {
+		i += step
+	}
+	for n := 0; n < len(m.Items); n++ {
+		i = (i + len(m.Items)) % len(m.Items)
+		if m.Items[i].selectable() {
+			m.selected = i
+			return
+		}
+		i += step
+	}
+}
+
+func (m *Menu) Update() {
+	if len(m.Items) == 0 {
+		if input.JustPressed(ActionBack) && m.OnBack != nil {
+			m.OnBack()
+		}
+		return
+	}
+
+	item := m.Items[m.selected]
+	if m.capturing {
+		if key, ok := JustPressedKey(); ok {
+			m.capturing = false
+			item.Bind(key)
+			// the bound key may be a menu key too, don't let it act now
+			input.Latch(ActionConfirm)
+			input.Latch(ActionBack)
+		}
+		return
+	}
+
+	switch {
+	case input.JustPressed(ActionUp):
+		m.move(-1)
+	case input.JustPressed(ActionDown):
+		m.move(1)
+	case input.JustPressed(ActionLeft) && item.Adjust != nil:
+		item.Adjust(-1)
+	case input.JustPressed(ActionRight) && item.Adjust != nil:
+		item.Adjust(1)
+	case input.JustPressed(ActionConfirm):
+		if item.Bind != nil {
+			m.capturing = true
+		} else if item.Activate != nil {
+			item.Activate()
+		} else if item.Adjust != nil {
+			item.Adjust(1)
+		}
+	case input.JustPressed(ActionBack):
+		if m.OnBack != nil {
+			m.OnBack()
+		}
+	}
+}
+
+// Draw dims the screen and draws the menu centered on it.
+func (m *Menu) Draw(screen *ebiten.Image, layout *HUDLayout) {
+	size := layout.Screen()
+	ebitenutil.DrawRect(screen, 0, 0, float64(size.X), float64(size.Y), menuDimColor)
+
+	scale := layout.Scale() * settings.TextScale
+	shadow := image.Point{int(math.Round(2 * scale)), int(math.Round(2 * scale))}
+
+	title := layout.Place(AnchorTopCenter, vec2.T{0, 100}, vec2.T{})
+	DrawText(screen, T(m.Title), fonts.Face(uiFont, 40*scale), int(title[0]), int(title[1]), TextStyle{
+		Color:       colornames.White,
+		Align:       AlignCenter,
+		Shadow:      shadow,
+		ShadowColor: uiOutlineColor,
+	})
+
+	face := fonts.Face(uiFont, 20*scale)
+	lineHeight := float64(face.Metrics().Height.Ceil()) * 1.4
+	top := layout.Place(AnchorCenter, vec2.T{}, vec2.T{0, lineHeight * float64(len(m.Items))})
+
+	for i, item := range m.Items {
+		text := ""
+		if item.Label != "" {
+			text = T(item.Label)
+		}
+		if item.Value != nil {
+			if text != "" {
+				text += "  "
+			}
+			text += item.Value()
+		}
+
+		style := TextStyle{Color: menuTextColor, Align: AlignCenter, Shadow: shadow, ShadowColor: uiOutlineColor}
+		if !item.selectable() {
+			style.Color = menuDisabledColor
+		}
+		if i == m.selected {
+			style.Color = menuSelectedColor
+			if m.capturing {
+				text = T(item.Label) + "  " + T("controls.press_key")
+			} else if item.Adjust != nil {
+				text = "< " + text + " >"
+			}
+		}
+
+		y := top[1] + lineHeight*float64(i) + float64(face.Metrics().Ascent.Ceil())
+		DrawText(screen, text, face, int(top[0]), int(y), style)
+	}
+
+	if len(m.Items) > 0 && m.Items[m.selected].Hint != nil {
+		hintFace := fonts.Face(uiFont, 14*scale)
+		lines := WrapText(hintFace, m.Items[m.selected].Hint(), int(float64(size.X)*.8))
+		hint := layout.Place(AnchorBottomCenter, vec2.T{0, 40}, vec2.T{0, float64(MeasureText(hintFace, strings.Join(lines, "\n")).Height)})
+		DrawText(screen, strings.Join(lines, "\n"), hintFace, int(hint[0]), int(hint[1])+hintFace.Metrics().Ascent.Ceil(), TextStyle{
+			Color:       menuTextColor,
+			Align:       AlignCenter,
+			Shadow:      shadow,
+			ShadowColor: uiOutlineColor,
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"0ms2/sim"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	log "github.com/sirupsen/logrus"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const metricsGraphKey = ebiten.KeyF5
+const metricsExportKey = ebiten.KeyF6
+
+// metricsHistory is how many frames the collector keeps, 10s at 60 FPS
+const metricsHistory = 600
+
+// The graph shows the last metricsGraphWidth frames, one pixel each, up to
+// metricsGraphMax ms
+const metricsGraphWidth = 300
+const metricsGraphHeight = 120
+const metricsGraphMax = 33.3
+
+// metricsColors tell the entities apart in the graph, in the order they were
+// first timed
+var metricsColors = []color.NRGBA{
+	{0x63, 0x9b, 0xff, 0xff}, {0x99, 0xe5, 0x50, 0xff}, {0xdf, 0x71, 0x26, 0xff},
+	{0xd7, 0x7b, 0xba, 0xff}, {0xfb, 0xf2, 0x36, 0xff}, {0x5f, 0xcd, 0xe4, 0xff},
+	{0xac, 0x32, 0x32, 0xff}, {0x8f, 0x97, 0x4a, 0xff},
+}
+var metricsOtherColor = color.NRGBA{0x84, 0x7e, 0x87, 0xff}
+var metricsBudgetColor = color.NRGBA{0xff, 0xff, 0xff, 0x80}
+
+// liveImages counts the ebiten images created and not yet disposed
+var liveImages int
+
+func imageAllocated() {
+	liveImages++
+}
+
+func imageDisposed() {
+	liveImages--
+}
+
+// MetricsSample is what happened in a frame, times are in ms.
+type MetricsSample struct {
+	// Time is since the collector started, Frame since the previous sample
+	Time   float64            `json:"time"`
+	Frame  float64            `json:"frame"`
+	Update map[string]float64 `json:"update"`
+	Draw   map[string]float64 `json:"draw"`
+
+	Planets  int `json:"planets"`
+	Powerups int `json:"powerups"`
+	Tiles    int `json:"tiles"`
+	Images   int `json:"images"`
+
+	O2       float64 `json:"o2"`
+	Fuel     float64 `json:"fuel"`
+	Altitude float64 `json:"altitude"`
+}
+
+// Metrics times every entity Update and Draw, and samples the game state
+// once per drawn frame.
+type Metrics struct {
+	ShowGraph bool
+
+	start   time.Time
+	last    time.Time
+	current MetricsSample
+	history []MetricsSample
+	// names are the timed entities, in the order they were first seen, by
+	// type so the entities of old runs aren't kept
+	names      []string
+	entityName map[reflect.Type]string
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		start:      time.Now(),
+		last:       time.Now(),
+		entityName: make(map[reflect.Type]string),
+	}
+	m.reset()
+
+	return m
+}
+
+func (m *Metrics) reset() {
+	m.current = MetricsSample{
+		Update: make(map[string]float64),
+		Draw:   make(map[string]float64),
+	}
+}
+
+// name returns the type name of e, without package or pointer.
+func (m *Metrics) name(e GameEntities) string {
+	t := reflect.TypeOf(e)
+	if name, ok := m.entityName[t]; ok {
+		return name
+	}
+
+	name := t.String()
+	name = name[strings.LastIndex(name, ".")+1:]
+	m.entityName[t] = name
+
+	for _, n := range m.names {
+		if n == name {
+			return name
+		}
+	}
+	m.names = append(m.names, name)
+
+	return name
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Update runs e.Update and times it.
+func (m *Metrics) Update(e GameEntities, screen *ebiten.Image, delta int64) {
+	start := time.Now()
+	e.Update(screen, delta)
+	m.current.Update[m.name(e)] += ms(time.Since(start))
+}
+
+// Draw runs e.Draw and times it.
+func (m *Metrics) Draw(e GameEntities, screen *ebiten.Image) {
+	start := time.Now()
+	e.Draw(screen)
+	m.current.Draw[m.name(e)] += ms(time.Since(start))
+}
+
+// EndFrame samples the game state and stores the frame in the history.
+func (m *Metrics) EndFrame(g *Game) {
+	now := time.Now()
+	m.current.Time = ms(now.Sub(m.start))
+	m.current.Frame = ms(now.Sub(m.last))
+	m.last = now
+
+	m.current.Planets = len(g.planets.Active)
+	m.current.Powerups = len(g.powerups.Active)
+	m.current.Tiles = len(g.background.tiles)
+	m.current.Images = liveImages
+	m.current.O2 = g.player.O2
+	m.current.Fuel = g.player.Fuel
+	m.current.Altitude = g.player.RelativePosition[1]
+
+	m.history = append(m.history, m.current)
+	if len(m.history) > metricsHistory {
+		m.history = m.history[len(m.history)-metricsHistory:]
+	}
+	m.reset()
+}
+
+// HandleKeys toggles the graph and exports the history on their keys.
+func (m *Metrics) HandleKeys() {
+	if inpututil.IsKeyJustPressed(metricsGraphKey) {
+		m.ShowGraph = !m.ShowGraph
+	}
+
+	if inpututil.IsKeyJustPressed(metricsExportKey) {
+		name := "metrics-" + time.Now().Format("20060102-150405")
+		for _, ext := range []string{".csv", ".json"} {
+			path, err := configPath(name + ext)
+			if err == nil {
+				err = m.Export(path)
+			}
+
+			if err != nil {
+				log.WithField("file", name+ext).Errorln("can't export metrics:", err)
+			} else {
+				log.WithField("file", path).Infoln("metrics exported")
+			}
+		}
+	}
+}
+
+// Export writes the history to path, as JSON or CSV after its extension.
+func (m *Metrics) Export(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return m.WriteJSON(f)
+	}
+	return m.WriteCSV(f)
+}
+
+func (m *Metrics) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m.history)
+}
+
+// WriteCSV writes a frame per row, with an update and a draw column per entity.
+func (m *Metrics) WriteCSV(w io.Writer) error {
+	names := append([]string(nil), m.names...)
+	sort.Strings(names)
+
+	header := []string{"time_ms", "frame_ms"}
+	for _, name := range names {
+		header = append(header, "update_"+name+"_ms", "draw_"+name+"_ms")
+	}
+	header = append(header, "planets", "powerups", "tiles", "images", "o2", "fuel", "altitude_km")
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 3, 64)
+	}
+	for _, s := range m.history {
+		row := []string{f(s.Time), f(s.Frame)}
+		for _, name := range names {
+			row = append(row, f(s.Update[name]), f(s.Draw[name]))
+		}
+		row = append(row, strconv.Itoa(s.Planets), strconv.Itoa(s.Powerups), strconv.Itoa(s.Tiles),
+			strconv.Itoa(s.Images), f(s.O2), f(s.Fuel), f(s.Altitude))
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// DrawGraph draws the frame times as bars stacked by entity in the bottom
+// right corner, the line is the 60 FPS budget.
+func (m *Metrics) DrawGraph(screen *ebiten.Image) {
+	if !m.ShowGraph {
+		return
+	}
+
+	w, h := screen.Size()
+	x0 := float64(w - metricsGraphWidth - 8)
+	y0 := float64(h - metricsGraphHeight - 8)
+	ebitenutil.DrawRect(screen, x0, y0, metricsGraphWidth, metricsGraphHeight, debugPanelColor)
+
+	scale := metricsGraphHeight / metricsGraphMax
+	first := len(m.history) - metricsGraphWidth
+	if first < 0 {
+		first = 0
+	}
+
+	for i, s := range m.history[first:] {
+		x := x0 + float64(i)
+		y := y0 + metricsGraphHeight
+		timed := 0.0
+		for n, name := range m.names {
+			t := s.Update[name] + s.Draw[name]
+			timed += t
+			ebitenutil.DrawRect(screen, x, y-t*scale, 1, t*scale, metricsColors[n%len(metricsColors)])
+			y -= t * scale
+		}
+
+		// what the entities don't account for: ebiten, the GPU and vsync
+		if other := s.Frame - timed; other > 0 {
+			ebitenutil.DrawRect(screen, x, y0+metricsGraphHeight-s.Frame*scale, 1, other*scale, metricsOtherColor)
+		}
+	}
+
+	budget := y0 + metricsGraphHeight - sim.Tick*scale
+	ebitenutil.DrawLine(screen, x0, budget, x0+metricsGraphWidth, budget, metricsBudgetColor)
+
+	for n, name := range m.names {
+		ly := y0 - float64(len(m.names)-n)*debugLineHeight - debugLineHeight
+		ebitenutil.DrawRect(screen, x0, ly+4, 8, 8, metricsColors[n%len(metricsColors)])
+		ebitenutil.DebugPrintAt(screen, name, int(x0)+12, int(ly))
+	}
+
+	if len(m.history) > 0 {
+		s := m.history[len(m.history)-1]
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%.1fms  planets %d  powerups %d  tiles %d  images %d",
+			s.Frame, s.Planets, s.Powerups, s.Tiles, s.Images), int(x0), int(y0)-debugLineHeight)
+	}
+}
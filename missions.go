@@ -0,0 +1,271 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/ungerik/go3d/float64/vec2"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// missionsPerRun are offered at every launch, one of each kind
+const missionsPerRun = 3
+
+// What missions ask for is picked from these. Altitudes are in km, fuel in
+// % of the tank and flyby distances in world pixels from a planet's surface.
+// The altitudes are above sim.LiftOffAltitude, the lift-off gets there
+// without burning fuel.
+var missionAltitudes = []float64{500, 750, 1000, 1500, 2000}
+var missionFuel = []float64{10, 20, 30, 40}
+var missionO2Counts = []int{2, 3, 4, 5}
+var missionFlybys = []float64{120, 80, 40}
+
+// A completed mission tops up o2 or fuel by a random amount in this range
+const missionRewardMin = 30
+const missionRewardMax = 60
+
+var missionDoneColor = color.RGBA{0x6a, 0xbe, 0x30, 0xFF}
+
+// MissionKind is what a mission asks for.
+type MissionKind int
+
+const (
+	// MissionAltitude is reaching Altitude with at least Fuel left
+	MissionAltitude MissionKind = iota
+	// MissionCollectO2 is collecting Count o2 tanks
+	MissionCollectO2
+	// MissionFlyby is passing within Radius of a planet's surface
+	MissionFlyby
+)
+
+// Mission is an optional goal of a run. When it is done the J0hn who did it
+// gets Amount of the Reward resource, in co-op the players share the
+// missions.
+type Mission struct {
+	Kind     MissionKind
+	Altitude float64
+	Fuel     float64
+	Count    int
+	Radius   float64
+
+	Reward sim.PowerupType
+	Amount float64
+
+	Done bool
+	// progress is from 0 to 1, closest is the nearest J0hn got to a planet
+	progress  float64
+	collected int
+	collector *sim.J0hn
+	closest   float64
+}
+
+// Description is the mission in the current language.
+func (m *Mission) Description() string {
+	switch m.Kind {
+	case MissionAltitude:
+		return T("mission.altitude", FormatDistance(m.Altitude), int(m.Fuel))
+	case MissionCollectO2:
+		return TN("mission.collect_o2", m.Count, m.Count)
+	}
+	return T("mission.flyby", FormatDistance(m.Radius/pixelsPerKm))
+}
+
+// RewardDescription is what completing the mission gives.
+func (m *Mission) RewardDescription() string {
+	return T("mission.reward", int(m.Amount), T(powerupMessageKey(m.Reward)))
+}
+
+// Status is how far along the mission is, for the HUD and the results.
+func (m *Mission) Status() string {
+	if m.Done {
+		return T("mission.done")
+	}
+	if m.Kind == MissionFlyby {
+		if math.IsInf(m.closest, 1) {
+			return "-"
+		}
+		return FormatDistance(m.closest / pixelsPerKm)
+	}
+	return percent(m.progress)
+}
+
+func powerupMessageKey(puType sim.PowerupType) string {
+	if puType == sim.O2Type {
+		return "hud.o2"
+	}
+	return "hud.fuel"
+}
+
+// Missions offers new missions when J0hn launches, follows them through the
+// run and hands the rewards out. It is drawn on the HUD while there are any.
+type Missions struct {
+	List []*Mission
+
+	players []*sim.J0hn
+	planets *sim.PlanetsSpawner
+	layout  *HUDLayout
+	rng     *rand.Rand
+}
+
+func NewMissions(layout *HUDLayout) *Missions {
+	m := &Missions{layout: layout}
+	events.Subscribe(m.handle)
+	return m
+}
+
+// Watch follows the J0hns of a new run, its missions come from seed. A run
+// without players, like a network race, has no missions.
+func (m *Missions) Watch(players []*sim.J0hn, planets *sim.PlanetsSpawner, seed int64) {
+	m.players = players
+	m.planets = planets
+	m.rng = rand.New(rand.NewSource(seed))
+	m.List = nil
+}
+
+func (m *Missions) handle(e sim.Event) {
+	switch e.Kind {
+	case sim.EventLaunch:
+		// J0hn keeps lifting off until he is flying
+		if settings.Missions && m.players != nil && len(m.List) == 0 {
+			m.generate()
+		}
+	case sim.EventPickup:
+		for _, mission := range m.List {
+			if mission.Kind == MissionCollectO2 && e.Powerup == sim.O2Type {
+				mission.collected++
+				mission.collector = e.Player
+			}
+		}
+	}
+}
+
+// generate picks one mission of each kind, with their rewards.
+func (m *Missions) generate() {
+	m.List = nil
+	for kind := MissionKind(0); kind < missionsPerRun; kind++ {
+		mission := &Mission{
+			Kind:    kind,
+			Reward:  sim.O2Type,
+			Amount:  float64(missionRewardMin + m.rng.Intn(missionRewardMax-missionRewardMin+1)),
+			closest: math.Inf(1),
+		}
+		if m.rng.Intn(2) == 1 {
+			mission.Reward = sim.FuelType
+		}
+
+		switch kind {
+		case MissionAltitude:
+			mission.Altitude = missionAltitudes[m.rng.Intn(len(missionAltitudes))]
+			mission.Fuel = missionFuel[m.rng.Intn(len(missionFuel))]
+		case MissionCollectO2:
+			mission.Count = missionO2Counts[m.rng.Intn(len(missionO2Counts))]
+		case MissionFlyby:
+			mission.Radius = missionFlybys[m.rng.Intn(len(missionFlybys))]
+		}
+
+		m.List = append(m.List, mission)
+		progressLog.WithField("mission", mission.Description()).Debugln("mission offered")
+	}
+}
+
+// Completed is how many missions of the run are done.
+func (m *Missions) Completed() int {
+	n := 0
+	for _, mission := range m.List {
+		if mission.Done {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *Missions) Update(_ *ebiten.Image, delta int64) {
+	if delta == 0 {
+		return
+	}
+
+	for _, player := range m.players {
+		if player.Flying {
+			m.follow(player)
+		}
+	}
+}
+
+// follow checks the missions player can do.
+func (m *Missions) follow(player *sim.J0hn) {
+	for _, mission := range m.List {
+		if mission.Done {
+			continue
+		}
+
+		switch mission.Kind {
+		case MissionAltitude:
+			mission.progress = math.Max(mission.progress, clamp01(player.RelativePosition[1]/mission.Altitude))
+			if player.RelativePosition[1] >= mission.Altitude && player.Fuel >= mission.Fuel {
+				m.complete(mission, player)
+			}
+		case MissionCollectO2:
+			mission.progress = clamp01(float64(mission.collected) / float64(mission.Count))
+			if mission.collected >= mission.Count {
+				m.complete(mission, mission.collector)
+			}
+		case MissionFlyby:
+			m.flyby(mission, player)
+		}
+	}
+}
+
+// flyby keeps the nearest player got to the surface of a planet.
+func (m *Missions) flyby(mission *Mission, player *sim.J0hn) {
+	center := player.Center()
+	for _, planet := range m.planets.Active {
+		offset := planet.Center()
+		offset.Sub(&center)
+		distance := offset.Length() - sim.PlanetSize*sim.PlanetScale/2
+		mission.closest = math.Max(0, math.Min(mission.closest, distance))
+	}
+
+	if mission.closest <= mission.Radius {
+		m.complete(mission, player)
+	}
+}
+
+func (m *Missions) complete(mission *Mission, player *sim.J0hn) {
+	mission.Done = true
+	mission.progress = 1
+
+	if mission.Reward == sim.O2Type {
+		player.AddO2(mission.Amount)
+	} else {
+		player.AddFuel(mission.Amount)
+	}
+	playPickup(mission.Reward)
+	progressLog.WithField("mission", mission.Description()).Infoln("mission completed")
+}
+
+// Draw lists the missions in the top left corner, done ones in green.
+func (m *Missions) Draw(screen *ebiten.Image) {
+	if len(m.List) == 0 {
+		return
+	}
+
+	scale := m.layout.Scale() * settings.TextScale
+	face := fonts.Face(uiFont, 14*scale)
+	lineHeight := float64(face.Metrics().Height.Ceil()) * 1.3
+	pos := m.layout.Place(AnchorTopLeft, vec2.T{uiMarginLeft, 40}, vec2.T{})
+
+	style := TextStyle{
+		Outline:      int(math.Max(1, math.Round(scale))),
+		OutlineColor: uiOutlineColor,
+	}
+	for i, mission := range m.List {
+		style.Color = menuTextColor
+		if mission.Done {
+			style.Color = missionDoneColor
+		}
+
+		y := pos[1] + lineHeight*float64(i+1)
+		DrawText(screen, mission.Description()+"  "+mission.Status(), face, int(pos[0]), int(y), style)
+	}
+}
@@ -0,0 +1,394 @@
+// Package mixer plays the sounds and the music of the game through a backend
+// that makes the players, the game's plays through the sound card.
+package mixer
+
+import (
+	"bytes"
+	"encoding/binary"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// SampleRate is the rate of the samples the players read
+const SampleRate = 44100
+
+// Music tracks
+const (
+	musicMenu   = "menu"
+	musicFlight = "flight"
+)
+
+// musicFade is how long the music takes to crossfade, in seconds
+const musicFade = 2.0
+
+// The jetpack fades in and out in jetpackFade seconds, its pitch goes from
+// jetpackPitchMin at rest to jetpackPitchMax at jetpackPitchSpeed
+const jetpackFade = 0.08
+const jetpackPitchMin = 0.8
+const jetpackPitchMax = 1.5
+const jetpackPitchSpeed = 50
+
+// J0hn starts breathing hard under lowO2, faster and louder as it runs out
+const lowO2 = 30
+const breathFade = 0.5
+const breathRateMax = 1.8
+
+// Log logs through the standard logrus logger until the game points it at
+// its audio subsystem logger
+var Log = log.WithField("subsystem", "audio")
+
+// Bus groups sounds under a volume of their own, the master volume scales
+// them all.
+type Bus int
+
+const (
+	BusMusic Bus = iota
+	BusSfx
+)
+
+// Sound is a one shot sound effect.
+type Sound int
+
+const (
+	SoundO2Pickup Sound = iota
+	SoundFuelPickup
+)
+
+// Volumes are the volumes of the buses from 0 to 1, Master scales the
+// others.
+type Volumes struct {
+	Master, Music, Sfx float64
+}
+
+// Flight is what the sounds follow of a J0hn.
+type Flight struct {
+	Altitude  float64
+	Speed     float64
+	O2        float64
+	Thrusting bool
+}
+
+// AudioPlayer plays a stream of 16 bit stereo samples at SampleRate.
+type AudioPlayer interface {
+	Play() error
+	Pause() error
+	Rewind() error
+	IsPlaying() bool
+	SetVolume(volume float64)
+	Close() error
+}
+
+// AudioBackend makes the players, the sound card of the game or nothing at
+// all.
+type AudioBackend interface {
+	NewPlayer(src io.ReadCloser) (AudioPlayer, error)
+}
+
+// NullAudioBackend makes players that keep track of their state and play
+// nothing, for headless runs and tests.
+type NullAudioBackend struct{}
+
+func (NullAudioBackend) NewPlayer(src io.ReadCloser) (AudioPlayer, error) {
+	return &NullPlayer{}, nil
+}
+
+type NullPlayer struct {
+	Playing bool
+	Volume  float64
+}
+
+func (p *NullPlayer) Play() error {
+	p.Playing = true
+	return nil
+}
+
+func (p *NullPlayer) Pause() error {
+	p.Playing = false
+	return nil
+}
+
+func (p *NullPlayer) Rewind() error {
+	return nil
+}
+
+func (p *NullPlayer) IsPlaying() bool {
+	return p.Playing
+}
+
+func (p *NullPlayer) SetVolume(volume float64) {
+	p.Volume = volume
+}
+
+func (p *NullPlayer) Close() error {
+	p.Playing = false
+	return nil
+}
+
+// loopStream plays samples over and over at a rate that can change while
+// the player reads it from its own goroutine. A rate of 2 is an octave up.
+type loopStream struct {
+	// rate holds the float64 bits, first so it is aligned for atomic
+	rate    uint64
+	samples []float32
+	pos     float64
+}
+
+func newLoopStream(samples []float32) *loopStream {
+	l := &loopStream{samples: samples}
+	l.SetRate(1)
+
+	return l
+}
+
+func (l *loopStream) SetRate(rate float64) {
+	atomic.StoreUint64(&l.rate, math.Float64bits(rate))
+}
+
+func (l *loopStream) Rate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&l.rate))
+}
+
+func (l *loopStream) Read(b []byte) (int, error) {
+	rate := l.Rate()
+	n := len(b) / 4 * 4
+
+	for i := 0; i < n; i += 4 {
+		// linear interpolation between the samples around pos
+		idx := int(l.pos)
+		frac := float32(l.pos - float64(idx))
+		a, c := l.samples[idx], l.samples[(idx+1)%len(l.samples)]
+		putSample(b[i:], a+(c-a)*frac)
+
+		l.pos += rate
+		for l.pos >= float64(len(l.samples)) {
+			l.pos -= float64(len(l.samples))
+		}
+	}
+
+	return n, nil
+}
+
+func (l *loopStream) Close() error {
+	return nil
+}
+
+// putSample writes v to both channels of the frame at b.
+func putSample(b []byte, v float32) {
+	s := int16(math.Max(-1, math.Min(1, float64(v))) * math.MaxInt16)
+	binary.LittleEndian.PutUint16(b, uint16(s))
+	binary.LittleEndian.PutUint16(b[2:], uint16(s))
+}
+
+// pcm converts samples to what the players read.
+func pcm(samples []float32) []byte {
+	b := make([]byte, len(samples)*4)
+	for i, v := range samples {
+		putSample(b[i*4:], v)
+	}
+
+	return b
+}
+
+type pcmReader struct {
+	*bytes.Reader
+}
+
+func (pcmReader) Close() error {
+	return nil
+}
+
+// audioLoop is a looping sound faded in and out by the manager.
+type audioLoop struct {
+	// stream is nil for the generated music
+	stream *loopStream
+	player AudioPlayer
+	bus    Bus
+	// level is where the fade is, gain how loud the sound is at its peak
+	level float64
+	gain  float64
+}
+
+// Audio mixes the game sounds: the jetpack, J0hn's breathing, the pickup
+// chimes and the music.
+type Audio struct {
+	backend AudioBackend
+	effects map[Sound]AudioPlayer
+	jetpack *audioLoop
+	breath  *audioLoop
+	music   map[string]*audioLoop
+	// generator plays the flight music
+	generator *MusicGenerator
+	// track is the music playing or fading in
+	track string
+	last  time.Time
+	// volumes are read every time a sound is played or faded
+	volumes func() Volumes
+}
+
+func NewAudio(backend AudioBackend) *Audio {
+	a := &Audio{
+		backend: backend,
+		effects: make(map[Sound]AudioPlayer),
+		music:   make(map[string]*audioLoop),
+		last:    time.Now(),
+		volumes: func() Volumes { return Volumes{Master: 1, Music: 1, Sfx: 1} },
+	}
+
+	a.effects[SoundO2Pickup] = a.newPlayer(pcmReader{bytes.NewReader(pcm(o2ChimeSamples))})
+	a.effects[SoundFuelPickup] = a.newPlayer(pcmReader{bytes.NewReader(pcm(fuelChimeSamples))})
+	a.jetpack = a.newLoop(jetpackSamples, BusSfx)
+	a.breath = a.newLoop(breathSamples, BusSfx)
+	for name, samples := range musicSamples {
+		a.music[name] = a.newLoop(samples, BusMusic)
+	}
+	a.generator = NewMusicGenerator(time.Now().UnixNano())
+	a.music[musicFlight] = &audioLoop{player: a.newPlayer(a.generator), bus: BusMusic, gain: 1}
+
+	return a
+}
+
+// SetVolumes plays the buses at what volumes returns, at full volume until
+// then.
+func (a *Audio) SetVolumes(volumes func() Volumes) *Audio {
+	a.volumes = volumes
+	return a
+}
+
+// newPlayer falls back to a silent player, a missing sound isn't worth
+// stopping the game.
+func (a *Audio) newPlayer(src io.ReadCloser) AudioPlayer {
+	p, err := a.backend.NewPlayer(src)
+	if err != nil {
+		Log.Errorln("can't create player:", err)
+		return &NullPlayer{}
+	}
+
+	return p
+}
+
+func (a *Audio) newLoop(samples []float32, bus Bus) *audioLoop {
+	stream := newLoopStream(samples)
+	return &audioLoop{stream: stream, player: a.newPlayer(stream), bus: bus, gain: 1}
+}
+
+func (a *Audio) busVolume(bus Bus) float64 {
+	volumes := a.volumes()
+	volume := volumes.Sfx
+	if bus == BusMusic {
+		volume = volumes.Music
+	}
+
+	return volumes.Master * volume
+}
+
+// Play plays a sound effect from the start.
+func (a *Audio) Play(sound Sound) {
+	p, ok := a.effects[sound]
+	if !ok {
+		return
+	}
+
+	p.SetVolume(a.busVolume(BusSfx))
+	if err := p.Rewind(); err != nil {
+		Log.WithField("sound", sound).Errorln("can't rewind:", err)
+	}
+	_ = p.Play()
+}
+
+// PlayMusic crossfades to track, the music keeps playing where it was if it
+// was still fading out.
+func (a *Audio) PlayMusic(track string) {
+	if _, ok := a.music[track]; !ok {
+		Log.WithField("track", track).Warnln("unknown music track")
+		return
+	}
+
+	a.track = track
+}
+
+// fade moves the loop level to target in duration seconds and starts or
+// stops its player as it becomes audible or silent, its bus at volume.
+func (l *audioLoop) fade(target, duration, dt, volume float64) {
+	step := dt / duration
+	if l.level < target {
+		l.level = math.Min(target, l.level+step)
+	} else {
+		l.level = math.Max(target, l.level-step)
+	}
+
+	l.player.SetVolume(l.level * l.gain * volume)
+	if l.level > 0 && !l.player.IsPlaying() {
+		_ = l.player.Play()
+	} else if l.level == 0 && l.player.IsPlaying() {
+		_ = l.player.Pause()
+	}
+}
+
+// Update follows the flights of the J0hns: the jetpack sounds while one
+// thrusts, higher the faster the fastest goes, and breathing gets harder as
+// the lowest o2 runs out. Both stop while the game isn't simulating. The
+// flight music plays while running, following the highest altitude, the top
+// speed and the lowest o2.
+func (a *Audio) Update(flights []Flight, running, simulating bool) {
+	now := time.Now()
+	dt := now.Sub(a.last).Seconds()
+	a.last = now
+
+	a.update(flights, running, simulating, dt)
+}
+
+// update moves the sounds dt seconds on.
+func (a *Audio) update(flights []Flight, running, simulating bool, dt float64) {
+	thrusting := 0.0
+	params := MusicParams{Altitude: math.Inf(-1), O2: math.Inf(1)}
+	for _, f := range flights {
+		if simulating && f.Thrusting {
+			thrusting = 1
+		}
+		params.Altitude = math.Max(params.Altitude, f.Altitude)
+		params.Speed = math.Max(params.Speed, f.Speed)
+		params.O2 = math.Min(params.O2, f.O2)
+	}
+
+	speed := math.Min(params.Speed/jetpackPitchSpeed, 1)
+	a.jetpack.stream.SetRate(jetpackPitchMin + speed*(jetpackPitchMax-jetpackPitchMin))
+	a.jetpack.fade(thrusting, jetpackFade, dt, a.busVolume(BusSfx))
+
+	breathing := 0.0
+	if simulating && params.O2 < lowO2 {
+		breathing = 1
+		intensity := (lowO2 - math.Max(params.O2, 0)) / lowO2
+		a.breath.gain = 0.4 + 0.6*intensity
+		a.breath.stream.SetRate(1 + intensity*(breathRateMax-1))
+	}
+	a.breath.fade(breathing, breathFade, dt, a.busVolume(BusSfx))
+
+	a.generator.Set(params)
+	if running {
+		a.PlayMusic(musicFlight)
+	} else {
+		a.PlayMusic(musicMenu)
+	}
+	for name, track := range a.music {
+		target := 0.0
+		if name == a.track {
+			target = 1
+		}
+		track.fade(target, musicFade, dt, a.busVolume(track.bus))
+	}
+}
+
+// Close stops every sound.
+func (a *Audio) Close() {
+	for _, p := range a.effects {
+		_ = p.Close()
+	}
+	for _, l := range a.music {
+		_ = l.player.Close()
+	}
+	_ = a.jetpack.player.Close()
+	_ = a.breath.player.Close()
+}
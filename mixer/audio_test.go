@@ -0,0 +1,135 @@
+package mixer
+
+import (
+	"math"
+	"testing"
+)
+
+const audioEpsilon = 1e-9
+
+// newTestAudio plays nothing at the volumes.
+func newTestAudio(volumes *Volumes) *Audio {
+	return NewAudio(NullAudioBackend{}).SetVolumes(func() Volumes { return *volumes })
+}
+
+func nullPlayer(t *testing.T, p AudioPlayer) *NullPlayer {
+	null, ok := p.(*NullPlayer)
+	if !ok {
+		t.Fatalf("expected a NullPlayer, got %T", p)
+	}
+	return null
+}
+
+func expectLoop(t *testing.T, a *Audio, name string, l *audioLoop, level float64, playing bool) {
+	t.Helper()
+
+	p := nullPlayer(t, l.player)
+	if math.Abs(l.level-level) > audioEpsilon {
+		t.Errorf("%s: expected level %g, got %g", name, level, l.level)
+	}
+	if volume := level * l.gain * a.busVolume(l.bus); math.Abs(p.Volume-volume) > audioEpsilon {
+		t.Errorf("%s: expected volume %g, got %g", name, volume, p.Volume)
+	}
+	if p.Playing != playing {
+		t.Errorf("%s: expected playing %v, got %v", name, playing, p.Playing)
+	}
+}
+
+func TestBusVolume(t *testing.T) {
+	volumes := Volumes{Master: .5, Music: .4, Sfx: .8}
+	a := newTestAudio(&volumes)
+
+	if v := a.busVolume(BusMusic); math.Abs(v-.2) > audioEpsilon {
+		t.Errorf("expected a music volume of .2, got %g", v)
+	}
+	if v := a.busVolume(BusSfx); math.Abs(v-.4) > audioEpsilon {
+		t.Errorf("expected an sfx volume of .4, got %g", v)
+	}
+
+	a.Play(SoundO2Pickup)
+	p := nullPlayer(t, a.effects[SoundO2Pickup])
+	if !p.Playing || math.Abs(p.Volume-.4) > audioEpsilon {
+		t.Errorf("expected the chime playing at .4, got %v at %g", p.Playing, p.Volume)
+	}
+
+	volumes.Master = 0
+	a.Play(SoundFuelPickup)
+	if v := nullPlayer(t, a.effects[SoundFuelPickup]).Volume; v != 0 {
+		t.Errorf("expected a muted chime, got %g", v)
+	}
+}
+
+func TestJetpackFade(t *testing.T) {
+	a := newTestAudio(&Volumes{Master: 1, Music: 1, Sfx: .5})
+	flights := []Flight{{O2: 100, Thrusting: true}}
+
+	a.update(flights, true, true, jetpackFade/2)
+	expectLoop(t, a, "half faded in", a.jetpack, .5, true)
+	a.update(flights, true, true, jetpackFade)
+	expectLoop(t, a, "faded in", a.jetpack, 1, true)
+
+	flights[0].Thrusting = false
+	a.update(flights, true, true, jetpackFade/2)
+	expectLoop(t, a, "half faded out", a.jetpack, .5, true)
+	a.update(flights, true, true, jetpackFade/2)
+	expectLoop(t, a, "faded out", a.jetpack, 0, false)
+
+	// it stops under a menu even while J0hn holds thrust
+	flights[0].Thrusting = true
+	a.update(flights, true, true, jetpackFade)
+	a.update(flights, true, false, jetpackFade)
+	expectLoop(t, a, "paused", a.jetpack, 0, false)
+}
+
+func TestBreathBelowLowO2(t *testing.T) {
+	a := newTestAudio(&Volumes{Master: 1, Music: 1, Sfx: 1})
+
+	a.update([]Flight{{O2: lowO2}}, true, true, breathFade)
+	expectLoop(t, a, "enough o2", a.breath, 0, false)
+
+	// the lowest o2 of the J0hns counts
+	flights := []Flight{{O2: 100}, {O2: lowO2 / 2}}
+	a.update(flights, true, true, breathFade)
+	if math.Abs(a.breath.gain-.7) > audioEpsilon {
+		t.Errorf("expected a gain of .7 at half o2, got %g", a.breath.gain)
+	}
+	if rate := a.breath.stream.Rate(); math.Abs(rate-(1+(breathRateMax-1)/2)) > audioEpsilon {
+		t.Errorf("expected a rate halfway to %g, got %g", breathRateMax, rate)
+	}
+	expectLoop(t, a, "half o2", a.breath, 1, true)
+
+	flights[1].O2 = 0
+	a.update(flights, true, true, breathFade)
+	if math.Abs(a.breath.gain-1) > audioEpsilon || math.Abs(a.breath.stream.Rate()-breathRateMax) > audioEpsilon {
+		t.Errorf("expected full breathing without o2, got gain %g rate %g", a.breath.gain, a.breath.stream.Rate())
+	}
+
+	flights[1].O2 = 100
+	a.update(flights, true, true, breathFade)
+	expectLoop(t, a, "o2 back", a.breath, 0, false)
+}
+
+func TestMusicCrossfade(t *testing.T) {
+	a := newTestAudio(&Volumes{Master: 1, Music: .5, Sfx: 1})
+	flights := []Flight{{O2: 100}}
+
+	a.update(flights, false, false, musicFade)
+	expectLoop(t, a, "menu", a.music[musicMenu], 1, true)
+	expectLoop(t, a, "flight", a.music[musicFlight], 0, false)
+
+	a.update(flights, true, true, musicFade/2)
+	if a.track != musicFlight {
+		t.Errorf("expected the flight music, got %q", a.track)
+	}
+	expectLoop(t, a, "menu fading out", a.music[musicMenu], .5, true)
+	expectLoop(t, a, "flight fading in", a.music[musicFlight], .5, true)
+
+	a.update(flights, true, true, musicFade/2)
+	expectLoop(t, a, "menu faded out", a.music[musicMenu], 0, false)
+	expectLoop(t, a, "flight faded in", a.music[musicFlight], 1, true)
+
+	// back to the menu it crossfades from where the flight music is
+	a.update(flights, false, false, musicFade/4)
+	expectLoop(t, a, "flight fading out", a.music[musicFlight], .75, true)
+	expectLoop(t, a, "menu fading in", a.music[musicMenu], .25, true)
+}
@@ -0,0 +1,347 @@
+package mixer
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sync"
+)
+
+// The music gets as deep as it goes at musicSpaceAltitude km, depth grows
+// with the log of altitude like the zone floors do
+const musicSpaceAltitude = 10000
+
+// It gets tense under musicTensionO2 of o2, and fastest at musicTopSpeed
+const musicTensionO2 = 50
+const musicTopSpeed = 50
+
+const musicMinBPM = 64
+const musicMaxBPM = 132
+
+// musicSmoothing is how much of the way to the new params the music moves on
+// every step, so layers fade rather than cut
+const musicSmoothing = 0.08
+
+// musicModes go from bright to eerie, deeper altitudes pick later ones
+var musicModes = [][]int{
+	{0, 2, 4, 5, 7, 9, 11}, // ionian
+	{0, 2, 3, 5, 7, 9, 10}, // dorian
+	{0, 1, 3, 5, 7, 8, 10}, // phrygian
+	{0, 1, 3, 5, 6, 8, 10}, // locrian
+}
+
+// musicKeys is the root of every mode, as a MIDI note
+var musicKeys = []int{48, 45, 43, 42}
+
+// musicProgression are the chord degrees, one per bar
+var musicProgression = []int{0, 5, 3, 4}
+
+// MusicParams is what the music reacts to.
+type MusicParams struct {
+	// Altitude is in km, Speed as J0hn's velocity length
+	Altitude float64
+	Speed    float64
+	O2       float64
+}
+
+type musicWave int
+
+const (
+	waveSine musicWave = iota
+	waveTriangle
+	waveNoise
+)
+
+// musicVoice is a note: it rises to peak in attack and decays from there.
+type musicVoice struct {
+	freq    float64
+	phase   float64
+	wave    musicWave
+	level   float64
+	peak    float64
+	attack  float64
+	decay   float64
+	rising  bool
+	vibrato float64
+	// drop slides the pitch down on every sample, for drums
+	drop float64
+}
+
+func (v *musicVoice) sample(g *MusicGenerator) float64 {
+	if v.rising {
+		v.level += v.attack
+		if v.level >= v.peak {
+			v.level = v.peak
+			v.rising = false
+		}
+	} else {
+		v.level *= v.decay
+	}
+
+	freq := v.freq * (1 + v.vibrato*math.Sin(2*math.Pi*g.time*5))
+	v.freq *= v.drop
+	v.phase += freq / SampleRate
+	v.phase -= math.Floor(v.phase)
+
+	switch v.wave {
+	case waveTriangle:
+		return v.level * (4*math.Abs(v.phase-0.5) - 1)
+	case waveNoise:
+		return v.level * (g.rng.Float64()*2 - 1)
+	}
+	return v.level * math.Sin(2*math.Pi*v.phase)
+}
+
+// MusicGenerator is an endless PCM stream of generated music, in the format
+// AudioPlayer reads. The game sets its params while a player reads it.
+type MusicGenerator struct {
+	mu     sync.Mutex
+	target MusicParams
+
+	// the rest belongs to the reading goroutine
+	rng     *rand.Rand
+	params  MusicParams
+	voices  []*musicVoice
+	time    float64
+	toStep  float64
+	step    int
+	mode    int
+	key     int
+	chord   []int
+	lowPass float64
+}
+
+func NewMusicGenerator(seed int64) *MusicGenerator {
+	return &MusicGenerator{
+		rng:    rand.New(rand.NewSource(seed)),
+		target: MusicParams{O2: 100},
+		params: MusicParams{O2: 100},
+	}
+}
+
+// Set changes what the music reacts to, it follows within a few steps.
+func (g *MusicGenerator) Set(params MusicParams) {
+	g.mu.Lock()
+	g.target = params
+	g.mu.Unlock()
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// depth goes from 0 on the ground to 1 in deep space.
+func (g *MusicGenerator) depth() float64 {
+	return clamp01(math.Log10(1+math.Max(g.params.Altitude, 0)) / math.Log10(1+musicSpaceAltitude))
+}
+
+func (g *MusicGenerator) tension() float64 {
+	return clamp01((musicTensionO2 - g.params.O2) / musicTensionO2)
+}
+
+// BPM is the current tempo: faster with speed and tension, slower in space.
+func (g *MusicGenerator) BPM() float64 {
+	bpm := musicMinBPM + (musicMaxBPM-musicMinBPM)*(0.4*clamp01(g.params.Speed/musicTopSpeed)+0.4*g.tension()) -
+		16*g.depth()
+	return math.Max(musicMinBPM*0.75, bpm)
+}
+
+func midiFreq(note int) float64 {
+	return 440 * math.Pow(2, float64(note-69)/12)
+}
+
+// note returns degree of the current mode and key as a MIDI note, degrees
+// past the scale climb octaves. Degrees aren't negative.
+func (g *MusicGenerator) note(degree int) int {
+	scale := musicModes[g.mode]
+	octave := degree / len(scale)
+	return g.key + 12*octave + scale[degree-octave*len(scale)]
+}
+
+func (g *MusicGenerator) play(v *musicVoice) {
+	if v.decay == 0 {
+		v.decay = 1
+	}
+	if v.drop == 0 {
+		v.drop = 1
+	}
+	v.rising = v.attack > 0
+	if !v.rising {
+		v.level = v.peak
+	}
+
+	g.voices = append(g.voices, v)
+}
+
+// nextStep plays what falls on a sixteenth note.
+func (g *MusicGenerator) nextStep() {
+	g.mu.Lock()
+	target := g.target
+	g.mu.Unlock()
+
+	g.params.Altitude += (target.Altitude - g.params.Altitude) * musicSmoothing
+	g.params.Speed += (target.Speed - g.params.Speed) * musicSmoothing
+	g.params.O2 += (target.O2 - g.params.O2) * musicSmoothing
+
+	depth, tension := g.depth(), g.tension()
+	bar, beat := g.step/16, g.step%16
+	stepLength := 60 / g.BPM() / 4
+
+	// the key only changes on a new bar
+	if beat == 0 {
+		g.mode = int(depth*float64(len(musicModes)-1) + 0.5)
+		g.key = musicKeys[g.mode]
+		degree := musicProgression[bar%len(musicProgression)]
+		g.chord = []int{degree, degree + 2, degree + 4}
+
+		// the pad, wider and wobblier in space, with a tritone when tense
+		for _, d := range g.chord {
+			for _, detune := range []float64{1, 1.003 + 0.01*depth} {
+				g.play(&musicVoice{freq: midiFreq(g.note(d)) * detune, wave: waveSine,
+					peak: 0.06 * (0.6 + 0.4*depth), attack: 1 / (stepLength * 6 * SampleRate),
+					decay: math.Pow(0.02, 1/(stepLength*16*SampleRate)), vibrato: 0.004 * depth})
+			}
+		}
+		if tension > 0.3 {
+			g.play(&musicVoice{freq: midiFreq(g.note(g.chord[0]) + 6), wave: waveTriangle,
+				peak: 0.05 * tension, attack: 1 / (stepLength * 4 * SampleRate),
+				decay: math.Pow(0.05, 1/(stepLength*16*SampleRate))})
+		}
+	}
+
+	drums := clamp01(1 - depth*2.2)
+	if drums > 0 {
+		if beat%8 == 0 {
+			g.play(&musicVoice{freq: 110, wave: waveSine, peak: 0.5 * drums, decay: 0.9993, drop: 0.9997})
+		}
+		if beat%4 == 2 {
+			g.play(&musicVoice{wave: waveNoise, peak: 0.08 * drums, decay: 0.997})
+		}
+	}
+
+	bass := clamp01(1 - (depth-0.5)*2)
+	if bass > 0 && (beat == 0 || beat == 6 || beat == 10) {
+		d := g.chord[0]
+		if beat == 10 {
+			d = g.chord[2]
+		}
+		g.play(&musicVoice{freq: midiFreq(g.note(d) - 12), wave: waveTriangle, peak: 0.18 * bass,
+			decay: math.Pow(0.01, 1/(stepLength*5*SampleRate))})
+	}
+
+	// sparse high notes that ring for long in space, busy ones when tense
+	density := 0.45 - 0.3*depth + 0.4*tension
+	if g.rng.Float64() < density {
+		d := g.chord[g.rng.Intn(len(g.chord))] + 7*(1+g.rng.Intn(2))
+		ring := 2 + 12*depth
+		g.play(&musicVoice{freq: midiFreq(g.note(d)), wave: waveSine, peak: 0.09,
+			attack: 1 / (0.005 * SampleRate), decay: math.Pow(0.01, 1/(stepLength*ring*SampleRate))})
+	}
+
+	// a heartbeat when o2 runs low
+	if tension > 0 && (beat%8 == 0 || beat%8 == 2) {
+		g.play(&musicVoice{freq: 55, wave: waveSine, peak: 0.35 * tension, decay: 0.9990, drop: 0.9999})
+	}
+
+	g.step++
+	g.toStep += stepLength * SampleRate
+}
+
+// Read fills b with 16 bit stereo frames, it never runs out.
+func (g *MusicGenerator) Read(b []byte) (int, error) {
+	n := len(b) / 4 * 4
+
+	for i := 0; i < n; i += 4 {
+		if g.toStep <= 0 {
+			g.nextStep()
+		}
+		g.toStep--
+
+		v := 0.0
+		live := g.voices[:0]
+		for _, voice := range g.voices {
+			v += voice.sample(g)
+			if voice.rising || voice.level > 1e-4 {
+				live = append(live, voice)
+			}
+		}
+		g.voices = live
+		g.time += 1.0 / SampleRate
+
+		// darker in space
+		g.lowPass += (v - g.lowPass) * (1 - 0.7*g.depth())
+		putSample(b[i:], float32(math.Tanh(g.lowPass)))
+	}
+
+	return n, nil
+}
+
+func (g *MusicGenerator) Close() error {
+	return nil
+}
+
+// WriteWAV writes seconds of src, 16 bit stereo frames at SampleRate, as
+// a WAV file.
+func WriteWAV(w io.Writer, src io.Reader, seconds float64) error {
+	size := uint32(seconds*SampleRate) * 4
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'}, 36 + size, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16), uint16(1), uint16(2),
+		uint32(SampleRate), uint32(SampleRate * 4), uint16(4), uint16(16),
+		[4]byte{'d', 'a', 't', 'a'}, size,
+	}
+	for _, field := range header {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.CopyN(w, src, int64(size))
+	return err
+}
+
+// renderFlight is the flight RenderMusic plays along, t goes from 0 to 1: a
+// climb to deep space that speeds up and runs out of o2 on the last third.
+func renderFlight(t float64) MusicParams {
+	return MusicParams{
+		Altitude: math.Pow(1+musicSpaceAltitude, t) - 1,
+		Speed:    musicTopSpeed * math.Sin(math.Pi*t),
+		O2:       100 * clamp01((1-t)*3),
+	}
+}
+
+// RenderMusic writes seconds of the music to a WAV file at path, along a
+// scripted flight so every layer is heard.
+func RenderMusic(path string, seconds float64, seed int64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	g := NewMusicGenerator(seed)
+	src := &musicRender{generator: g, length: seconds}
+	if err := WriteWAV(f, src, seconds); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// musicRender moves the params along renderFlight as it is read.
+type musicRender struct {
+	generator *MusicGenerator
+	length    float64
+}
+
+func (r *musicRender) Read(b []byte) (int, error) {
+	r.generator.Set(renderFlight(r.generator.time / r.length))
+	// a tenth of a second at a time, so the params keep up
+	if max := SampleRate / 10 * 4; len(b) > max {
+		b = b[:max]
+	}
+
+	return r.generator.Read(b)
+}
@@ -0,0 +1,146 @@
+package mixer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Every sound is synthesized at start, mono samples from -1 to 1 at
+// SampleRate. They are deterministic so runs sound the same.
+
+// loopFade is how much of the end of a loop is blended into its start, so it
+// wraps around without a click
+const loopFade = 0.05
+
+// The chimes are arpeggios, one note every chimeStep seconds
+const chimeStep = 0.07
+const chimeDecay = 0.45
+
+// musicLoopLength is the length of the music tracks, in seconds. Their
+// frequencies are rounded to whole cycles of it so they loop seamlessly.
+const musicLoopLength = 8
+
+var jetpackSamples = synthJetpack()
+var breathSamples = synthBreath()
+var o2ChimeSamples = synthChime(1318.51, 1661.22, 1975.53)
+var fuelChimeSamples = synthChime(523.25, 783.99, 1046.5)
+
+// musicSamples are the looped music tracks by name, the flight music is
+// generated as it plays, see MusicGenerator
+var musicSamples = map[string][]float32{
+	musicMenu: synthPad(220, 261.63, 329.63, 440),
+}
+
+func seconds(s float64) int {
+	return int(s * SampleRate)
+}
+
+// loopable blends the last loopFade seconds of samples into the first ones
+// and drops them.
+func loopable(samples []float32) []float32 {
+	fade := seconds(loopFade)
+	n := len(samples) - fade
+	for i := 0; i < fade; i++ {
+		t := float32(i) / float32(fade)
+		samples[i] = samples[i]*t + samples[n+i]*(1-t)
+	}
+
+	return samples[:n]
+}
+
+// lowPass filters samples in place with a one pole filter, cutoff in Hz.
+func lowPass(samples []float32, cutoff float64) {
+	a := float32(1 - math.Exp(-2*math.Pi*cutoff/SampleRate))
+	var y float32
+	for i, x := range samples {
+		y += a * (x - y)
+		samples[i] = y
+	}
+}
+
+func noise(r *rand.Rand, n int) []float32 {
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = r.Float32()*2 - 1
+	}
+
+	return samples
+}
+
+// synthJetpack is a rumble of filtered noise with a slow flutter.
+func synthJetpack() []float32 {
+	r := rand.New(rand.NewSource(1))
+	samples := noise(r, seconds(1+loopFade))
+	lowPass(samples, 600)
+	lowPass(samples, 900)
+
+	for i := range samples {
+		t := float64(i) / SampleRate
+		flutter := 0.85 + 0.15*math.Sin(2*math.Pi*11*t)
+		samples[i] *= float32(2.2 * flutter)
+	}
+
+	return loopable(samples)
+}
+
+// synthBreath is an inhale and an exhale through a mask, two seconds long.
+func synthBreath() []float32 {
+	r := rand.New(rand.NewSource(2))
+	inhale := noise(r, seconds(2+loopFade))
+	exhale := append([]float32(nil), inhale...)
+	lowPass(inhale, 1800)
+	lowPass(exhale, 700)
+
+	samples := make([]float32, len(inhale))
+	for i := range samples {
+		t := float64(i) / SampleRate
+		switch {
+		case t < 0.8:
+			samples[i] = inhale[i] * float32(0.5*math.Sin(math.Pi*t/0.8))
+		case t >= 1 && t < 1.9:
+			samples[i] = exhale[i] * float32(0.9*math.Sin(math.Pi*(t-1)/0.9))
+		}
+	}
+
+	return loopable(samples)
+}
+
+// synthChime plays freqs one after the other, bell like.
+func synthChime(freqs ...float64) []float32 {
+	length := chimeStep*float64(len(freqs)) + 4*chimeDecay
+	samples := make([]float32, seconds(length))
+
+	for n, freq := range freqs {
+		start := seconds(chimeStep * float64(n))
+		for i := start; i < len(samples); i++ {
+			t := float64(i-start) / SampleRate
+			env := math.Exp(-t / chimeDecay)
+			v := math.Sin(2*math.Pi*freq*t) + 0.3*math.Sin(2*math.Pi*2.76*freq*t)*math.Exp(-t/0.1)
+			samples[i] += float32(0.25 * env * v)
+		}
+	}
+
+	return samples
+}
+
+// synthPad is a slow chord of freqs breathing in and out, musicLoopLength
+// seconds long.
+func synthPad(freqs ...float64) []float32 {
+	samples := make([]float32, seconds(musicLoopLength))
+	gain := 0.5 / float64(len(freqs))
+
+	for n, freq := range freqs {
+		freq = math.Round(freq*musicLoopLength) / musicLoopLength
+		// every voice swells at its own pace, still a whole number of times
+		// per loop
+		swell := float64(n%3+1) / musicLoopLength
+		for i := range samples {
+			t := float64(i) / SampleRate
+			env := 0.6 + 0.4*math.Sin(2*math.Pi*swell*t+float64(n))
+			v := math.Sin(2*math.Pi*freq*t) + 0.2*math.Sin(2*math.Pi*2*freq*t)
+			samples[i] += float32(gain * env * v)
+		}
+	}
+
+	return samples
+}
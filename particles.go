@@ -0,0 +1,321 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/ungerik/go3d/float64/vec2"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// particlePoolSize caps the live particles, emitters skip spawning while the
+// pool is full
+const particlePoolSize = 1024
+
+// Nozzles and the dust spots are in sprite pixels, directions are angles on
+// screen, 0 to the right and math.Pi/2 down
+var jetpackNozzles = []vec2.T{{19, 51}, {45, 51}}
+var platformDustSpots = []struct {
+	offset    vec2.T
+	direction float64
+}{
+	{vec2.T{12, 38}, math.Pi + .2},
+	{vec2.T{52, 38}, -.2},
+}
+
+type particle struct {
+	alive    bool
+	emitter  *Emitter
+	position vec2.T
+	velocity vec2.T
+	life     float64
+	maxLife  float64
+}
+
+// Emitter spawns particles at Rate per second while Active, or in bursts.
+// Their velocity is in px per tick, within Spread radians of Direction, and
+// they go through Colors and Sizes over their life.
+type Emitter struct {
+	Active    bool
+	Rate      float64
+	Lifetime  [2]float64
+	Speed     [2]float64
+	Direction float64
+	Spread    float64
+	Colors    []color.NRGBA
+	Sizes     []float64
+	Position  vec2.T
+
+	// anchor moves the emitter along with an entity before it spawns
+	anchor func(e *Emitter)
+	carry  float64
+}
+
+func NewEmitter() *Emitter {
+	return &Emitter{
+		Rate:     30,
+		Lifetime: [2]float64{500, 500},
+		Speed:    [2]float64{1, 1},
+		Colors:   []color.NRGBA{{0xff, 0xff, 0xff, 0xff}},
+		Sizes:    []float64{j0hnScale},
+	}
+}
+
+func (e *Emitter) SetRate(perSecond float64) *Emitter {
+	e.Rate = perSecond
+	return e
+}
+
+// SetLifetime sets the range of particle lives, in ms.
+func (e *Emitter) SetLifetime(min, max float64) *Emitter {
+	e.Lifetime = [2]float64{min, max}
+	return e
+}
+
+func (e *Emitter) SetSpeed(min, max float64) *Emitter {
+	e.Speed = [2]float64{min, max}
+	return e
+}
+
+// SetCone aims the emitter, particles leave within spread of direction.
+func (e *Emitter) SetCone(direction, spread float64) *Emitter {
+	e.Direction = direction
+	e.Spread = spread
+	return e
+}
+
+// SetColors sets the colors a particle goes through, evenly over its life.
+func (e *Emitter) SetColors(colors ...color.NRGBA) *Emitter {
+	e.Colors = colors
+	return e
+}
+
+// SetSizes sets the sizes a particle goes through, evenly over its life.
+func (e *Emitter) SetSizes(sizes ...float64) *Emitter {
+	e.Sizes = sizes
+	return e
+}
+
+// Attach calls anchor before every spawn, it places and aims the emitter
+// after an entity.
+func (e *Emitter) Attach(anchor func(e *Emitter)) *Emitter {
+	e.anchor = anchor
+	return e
+}
+
+func between(r [2]float64) float64 {
+	return r[0] + rand.Float64()*(r[1]-r[0])
+}
+
+// colorAt interpolates colors at t, from 0 to 1.
+func colorAt(colors []color.NRGBA, t float64) color.NRGBA {
+	if len(colors) == 1 {
+		return colors[0]
+	}
+
+	f := t * float64(len(colors)-1)
+	i := int(math.Min(f, float64(len(colors)-2)))
+	f -= float64(i)
+	a, b := colors[i], colors[i+1]
+	lerp := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*f)
+	}
+
+	return color.NRGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), lerp(a.A, b.A)}
+}
+
+// sizeAt interpolates sizes at t, from 0 to 1.
+func sizeAt(sizes []float64, t float64) float64 {
+	if len(sizes) == 1 {
+		return sizes[0]
+	}
+
+	f := t * float64(len(sizes)-1)
+	i := int(math.Min(f, float64(len(sizes)-2)))
+	return sizes[i] + (sizes[i+1]-sizes[i])*(f-float64(i))
+}
+
+// Particles owns the particle pool and the emitters of a run: the jetpack
+// exhaust, the pickup sparkles and the launch dust. Particles stay where they
+// were spawned in the sky, so they scroll with it.
+type Particles struct {
+	camera          *sim.Camera
+	pool            [particlePoolSize]particle
+	free            []int
+	emitters        []*Emitter
+	o2Sparkles      *Emitter
+	fuelSparkles    *Emitter
+	timeAccumulator float64
+}
+
+func NewParticles(camera *sim.Camera) *Particles {
+	p := &Particles{camera: camera}
+	for i := range p.pool {
+		p.free = append(p.free, i)
+	}
+
+	for _, player := range camera.Players() {
+		for _, nozzle := range jetpackNozzles {
+			player, nozzle := player, nozzle
+			p.AddEmitter(NewEmitter().
+				SetRate(70).
+				SetLifetime(250, 550).
+				SetSpeed(3, 6).
+				SetCone(math.Pi/2, .2).
+				SetColors(color.NRGBA{0xff, 0xff, 0xc0, 0xff}, color.NRGBA{0xdf, 0x71, 0x26, 0xd0}, color.NRGBA{0x84, 0x7e, 0x87, 0x00}).
+				SetSizes(j0hnScale, 3*j0hnScale).
+				Attach(func(e *Emitter) {
+					e.Active = player.IsAccelerating && player.Fuel > 0
+					e.Position, e.Direction = player.Nozzle(nozzle)
+				}))
+		}
+	}
+
+	p.o2Sparkles = NewEmitter().
+		SetLifetime(300, 700).
+		SetSpeed(1, 5).
+		SetCone(0, math.Pi).
+		SetColors(color.NRGBA{0xff, 0xff, 0xff, 0xff}, color.NRGBA{0x5f, 0xcd, 0xe4, 0xff}, color.NRGBA{0x63, 0x9b, 0xff, 0x00}).
+		SetSizes(2*j0hnScale, j0hnScale)
+	p.fuelSparkles = NewEmitter().
+		SetLifetime(300, 700).
+		SetSpeed(1, 5).
+		SetCone(0, math.Pi).
+		SetColors(color.NRGBA{0xff, 0xff, 0xff, 0xff}, color.NRGBA{0xfb, 0xf2, 0x36, 0xff}, color.NRGBA{0xdf, 0x71, 0x26, 0x00}).
+		SetSizes(2*j0hnScale, j0hnScale)
+
+	return p
+}
+
+// AddEmitter makes the pool feed e while it is active.
+func (p *Particles) AddEmitter(e *Emitter) *Particles {
+	p.emitters = append(p.emitters, e)
+	return p
+}
+
+// AttachPlatform kicks dust off the platform while J0hn lifts off it.
+func (p *Particles) AttachPlatform(platform *Platform) *Particles {
+	for _, spot := range platformDustSpots {
+		spot := spot
+		p.AddEmitter(NewEmitter().
+			SetRate(90).
+			SetLifetime(400, 900).
+			SetSpeed(1, 4).
+			SetCone(spot.direction, .3).
+			SetColors(color.NRGBA{0xd9, 0xa0, 0x66, 0xc0}, color.NRGBA{0x8f, 0x56, 0x3b, 0x00}).
+			SetSizes(2*j0hnScale, 4*j0hnScale).
+			Attach(func(e *Emitter) {
+				e.Active = p.camera.IsLifting
+				e.Position = platform.position
+				e.Position.Add(&spot.offset).Scale(j0hnScale)
+			}))
+	}
+
+	return p
+}
+
+// Sparkle bursts the sparkles of a powerup type at position.
+func (p *Particles) Sparkle(puType sim.PowerupType, position vec2.T) {
+	e := p.fuelSparkles
+	if puType == sim.O2Type {
+		e = p.o2Sparkles
+	}
+
+	e.Position = position
+	p.Burst(e, 32)
+}
+
+// Burst spawns n particles of e at once.
+func (p *Particles) Burst(e *Emitter, n int) {
+	for i := 0; i < n; i++ {
+		p.spawn(e)
+	}
+}
+
+func (p *Particles) spawn(e *Emitter) {
+	if len(p.free) == 0 {
+		return
+	}
+
+	i := p.free[len(p.free)-1]
+	p.free = p.free[:len(p.free)-1]
+
+	angle := e.Direction + (rand.Float64()*2-1)*e.Spread
+	speed := between(e.Speed)
+	life := between(e.Lifetime)
+	p.pool[i] = particle{
+		alive:    true,
+		emitter:  e,
+		position: e.Position,
+		velocity: vec2.T{math.Cos(angle) * speed, math.Sin(angle) * speed},
+		life:     life,
+		maxLife:  life,
+	}
+}
+
+func (p *Particles) Update(_ *ebiten.Image, delta int64) {
+	p.timeAccumulator += float64(delta)
+
+	for p.timeAccumulator >= sim.Tick {
+		p.timeAccumulator -= sim.Tick
+		elapsed := float64(sim.Tick)
+
+		for _, e := range p.emitters {
+			if e.anchor != nil {
+				e.anchor(e)
+			}
+			if !e.Active {
+				e.carry = 0
+				continue
+			}
+
+			e.carry += e.Rate * elapsed / 1000
+			for ; e.carry >= 1; e.carry-- {
+				p.spawn(e)
+			}
+		}
+
+		// same scroll as the ambient effects
+		scroll := copyVector(*p.camera.Velocity)
+		scroll.Scale(float64(sim.Tick) / 300)
+
+		for i := range p.pool {
+			particle := &p.pool[i]
+			if !particle.alive {
+				continue
+			}
+
+			particle.position.Add(&particle.velocity).Add(&scroll)
+			particle.life -= elapsed
+			if particle.life <= 0 {
+				particle.alive = false
+				p.free = append(p.free, i)
+			}
+		}
+	}
+}
+
+// Live counts the particles in use.
+func (p *Particles) Live() int {
+	return particlePoolSize - len(p.free)
+}
+
+func (p *Particles) Draw(screen *ebiten.Image) {
+	for i := range p.pool {
+		particle := &p.pool[i]
+		if !particle.alive {
+			continue
+		}
+
+		t := 1 - particle.life/particle.maxLife
+		size := snap(sizeAt(particle.emitter.Sizes, t))
+		if size <= 0 {
+			continue
+		}
+
+		x, y := snap(particle.position[0]-size/2), snap(particle.position[1]-size/2)
+		ebitenutil.DrawRect(screen, x, y, size, size, colorAt(particle.emitter.Colors, t))
+	}
+}
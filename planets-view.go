@@ -0,0 +1,51 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"image"
+	"path/filepath"
+)
+
+var planetsSprites []*ebiten.Image
+
+func init() {
+	planetFile := "planets.png"
+	img, _, err := ebitenutil.NewImageFromFile(filepath.Join(spritesPath, planetFile), ebiten.FilterNearest)
+	if err != nil {
+		planetsLog.WithField("sprite", planetFile).Error(err)
+	}
+	imageAllocated()
+
+	for i := 0; i < img.Bounds().Max.X/sim.PlanetSize; i++ {
+		sprite := img.SubImage(image.Rect(sim.PlanetSize*i, 0, sim.PlanetSize*(i+1), sim.PlanetSize)).(*ebiten.Image)
+		planetsSprites = append(planetsSprites, sprite)
+	}
+}
+
+// PlanetsView runs a PlanetsSpawner in the game loop and draws its planets.
+type PlanetsView struct {
+	*sim.PlanetsSpawner
+}
+
+func (v PlanetsView) Update(_ *ebiten.Image, delta int64) {
+	v.PlanetsSpawner.Update(delta)
+}
+
+func (v PlanetsView) Draw(screen *ebiten.Image) {
+	for _, planet := range v.Drawable {
+		drawPlanet(screen, planet)
+	}
+}
+
+func drawPlanet(screen *ebiten.Image, planet *sim.Planet) {
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(planet.Position[0], planet.Position[1])
+	op.GeoM.Scale(sim.PlanetScale, sim.PlanetScale)
+
+	err := screen.DrawImage(planetsSprites[planet.Sprite%len(planetsSprites)], op)
+	if err != nil {
+		planetsLog.Error(err)
+	}
+}
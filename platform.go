@@ -1,6 +1,7 @@
 package main
 
 import (
+	"0ms2/sim"
 	"github.com/hajimehoshi/ebiten"
 	"github.com/ungerik/go3d/float64/vec2"
 	"image"
@@ -21,14 +22,14 @@ type Platform struct {
 	position     vec2.T
 	currentFrame int
 	accumulator  int64
-	player       *J0hn
+	camera       *sim.Camera
 	initPos      float64
 }
 
-func NewPlatform(player *J0hn) *Platform {
+func NewPlatform(camera *sim.Camera) *Platform {
 	return &Platform{
-		player:  player,
-		initPos: player.position[1],
+		camera:  camera,
+		initPos: camera.Position[1],
 	}
 }
 
@@ -50,7 +51,7 @@ func (p *Platform) Draw(screen *ebiten.Image) {
 }
 
 func (p *Platform) Update(_ *ebiten.Image, delta int64) {
-	if p.position[1] == p.player.upPosition[1] {
+	if p.position[1] == p.camera.Players()[0].UpPosition[1] {
 		return
 	}
 
@@ -58,19 +59,24 @@ func (p *Platform) Update(_ *ebiten.Image, delta int64) {
 	w, _ := imgPlatform.Size()
 	platformTotalFrames := w / platformSize
 
-	if p.accumulator >= platformFrameInterval {
-		p.accumulator = 0
+	for p.accumulator >= platformFrameInterval {
+		p.accumulator -= platformFrameInterval
 
-		if (p.player.isLifting || p.player.flying) && p.player.position[1] < p.player.upPosition[1] {
-			p.player.position[1]++
+		animating := p.currentFrame != platformTotalFrames-1
+		if animating {
+			p.currentFrame++
 		}
 
-		if p.currentFrame != platformTotalFrames-1 {
-			p.currentFrame++
-			p.player.position[1]--
+		for _, player := range p.camera.Players() {
+			if (player.IsLifting || player.Flying) && player.Position[1] < player.UpPosition[1] {
+				player.Position[1]++
+			}
+			if animating {
+				player.Position[1]--
+			}
 		}
 
-		v := copyVector(*p.player.velocity)
+		v := copyVector(*p.camera.Velocity)
 		v.Scale(platformFrameInterval / 1000.0)
 
 		p.position.Add(&v)
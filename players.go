@@ -0,0 +1,69 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+	"image/color"
+)
+
+const maxPlayers = sim.MaxPlayers
+
+// coopBindings are the default flight keys of players 2 to 4, player 1 keeps
+// the usual ones.
+var coopBindings = [maxPlayers - 1]map[Action][]ebiten.Key{
+	{ActionThrust: {ebiten.KeyW}, ActionLeft: {ebiten.KeyA}, ActionRight: {ebiten.KeyD}},
+	{ActionThrust: {ebiten.KeyI}, ActionLeft: {ebiten.KeyJ}, ActionRight: {ebiten.KeyL}},
+	{ActionThrust: {ebiten.KeyKP8}, ActionLeft: {ebiten.KeyKP4}, ActionRight: {ebiten.KeyKP6}},
+}
+
+// flightActions are the actions the co-op players after the first can bind,
+// the first one runs the menus too.
+var flightActions = []Action{ActionThrust, ActionLeft, ActionRight}
+
+// playerActions are the actions player can rebind.
+func playerActions(player int) []Action {
+	if player == 0 {
+		return rebindableActions
+	}
+	return flightActions
+}
+
+// playerInputs are the controls of each player, the first is the input the
+// menus read too.
+var playerInputs [maxPlayers]*Input
+
+// playerTints colour every J0hn but the first so players can tell them
+// apart, playerColors are the same colours for the HUD.
+var playerTints = [maxPlayers][3]float64{{1, 1, 1}, {1, .55, .55}, {.55, 1, .55}, {1, .95, .4}}
+var playerColors = [maxPlayers]color.RGBA{
+	{0xcb, 0xdb, 0xfc, 0xFF},
+	{0xd9, 0x57, 0x63, 0xFF},
+	{0x6a, 0xbe, 0x30, 0xFF},
+	{0xfb, 0xf2, 0x36, 0xFF},
+}
+
+func init() {
+	playerInputs[0] = input
+	for i := 1; i < maxPlayers; i++ {
+		playerInputs[i] = NewPlayerInput(i)
+	}
+}
+
+// playerCount is how many players the runs have, from the settings.
+func playerCount() int {
+	if settings.Players < 1 {
+		return 1
+	}
+	if settings.Players > maxPlayers {
+		return maxPlayers
+	}
+	return settings.Players
+}
+
+// latchThrust keeps every player from thrusting until they let go, after the
+// key that closed a menu.
+func latchThrust() {
+	for _, in := range playerInputs {
+		in.Latch(ActionThrust)
+	}
+}
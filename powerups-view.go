@@ -0,0 +1,53 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"path/filepath"
+)
+
+var PowerupsSprites map[sim.PowerupType]*ebiten.Image
+
+func init() {
+	PowerupsSprites = make(map[sim.PowerupType]*ebiten.Image)
+	var err error
+	PowerupsSprites[sim.O2Type], _, err = ebitenutil.NewImageFromFile(filepath.Join(spritesPath, "o2.png"), ebiten.FilterNearest)
+	if err != nil {
+		powerupsLog.Error(err)
+	}
+	imageAllocated()
+
+	PowerupsSprites[sim.FuelType], _, err = ebitenutil.NewImageFromFile(filepath.Join(spritesPath, "gas.png"), ebiten.FilterNearest)
+	if err != nil {
+		powerupsLog.Error(err)
+	}
+	imageAllocated()
+}
+
+// PowerupsView runs a PowerupsSpawner in the game loop and draws its
+// powerups.
+type PowerupsView struct {
+	*sim.PowerupsSpawner
+}
+
+func (v PowerupsView) Update(_ *ebiten.Image, delta int64) {
+	v.PowerupsSpawner.Update(delta)
+}
+
+func (v PowerupsView) Draw(screen *ebiten.Image) {
+	for _, powerup := range v.Drawable {
+		drawPowerup(screen, powerup)
+	}
+}
+
+func drawPowerup(screen *ebiten.Image, powerup *sim.Powerup) {
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(powerup.Position[0], powerup.Position[1])
+	op.GeoM.Scale(sim.PowerupScale, sim.PowerupScale)
+
+	err := screen.DrawImage(PowerupsSprites[powerup.Type], op)
+	if err != nil {
+		powerupsLog.Error(err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/ungerik/go3d/float64/vec2"
+	"math"
+	"sort"
+)
+
+// RaceView runs a RaceClient in the game loop, it draws nothing.
+type RaceView struct {
+	*sim.RaceClient
+}
+
+func (v RaceView) Update(_ *ebiten.Image, delta int64) {
+	v.RaceClient.Update(delta)
+}
+
+func (v RaceView) Draw(*ebiten.Image) {}
+
+// drawOnly draws an entity the network moves, its own Update never runs.
+type drawOnly struct {
+	GameEntities
+}
+
+func (drawOnly) Update(*ebiten.Image, int64) {}
+
+// watchRace flies the run of the entities in the race of c. The entities the
+// snapshots move only draw, the ones it returns.
+func watchRace(c *sim.RaceClient, players []*sim.J0hn, camera *sim.Camera, planets *sim.PlanetsSpawner, powerups *sim.PowerupsSpawner,
+	entities []GameEntities) []GameEntities {
+	c.Watch(players, camera, planets, powerups)
+
+	// the client goes first, so everything follows the J0hns it moved
+	wrapped := []GameEntities{RaceView{c}}
+	for _, e := range entities {
+		switch e.(type) {
+		case J0hnView, PlanetsView, PowerupsView:
+			e = drawOnly{e}
+		}
+		wrapped = append(wrapped, e)
+	}
+	return wrapped
+}
+
+// drawStandings lists the pilots of the race of c from the highest down in
+// the top left corner, in their colours. Races have no missions to list
+// there.
+func drawStandings(screen *ebiten.Image, c *sim.RaceClient, layout *HUDLayout) {
+	players := c.Players()
+	scale := layout.Scale() * settings.TextScale
+	face := fonts.Face(uiFont, 14*scale)
+	lineHeight := float64(face.Metrics().Height.Ceil()) * 1.3
+	pos := layout.Place(AnchorTopLeft, vec2.T{uiMarginLeft, 40}, vec2.T{})
+	style := TextStyle{
+		Color:        menuTextColor,
+		Outline:      int(math.Max(1, math.Round(scale))),
+		OutlineColor: uiOutlineColor,
+	}
+
+	title := T("race.title")
+	if players == nil {
+		title = T("race.waiting")
+	} else if c.Over() {
+		title = T("race.over")
+	}
+	DrawText(screen, title, face, int(pos[0]), int(pos[1]+lineHeight), style)
+	if players == nil {
+		return
+	}
+
+	order := make([]int, len(players))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return players[order[i]].RelativePosition[1] > players[order[j]].RelativePosition[1]
+	})
+
+	for rank, i := range order {
+		style.Color = playerColors[i]
+		line := T("race.standing", rank+1, c.Race().Pilots[i], FormatDistance(players[i].RelativePosition[1]))
+		DrawText(screen, line, face, int(pos[0]), int(pos[1]+lineHeight*float64(rank+2)), style)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/ungerik/go3d/float64/vec2"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Powerups further than indicatorRange world pixels from J0hn get no arrow,
+// arrows shrink from indicatorMaxSize next to the screen to indicatorMinSize
+// at that range. Sizes and margins are in design units.
+const indicatorRange = 1200
+const indicatorMaxSize = 18
+const indicatorMinSize = 8
+const indicatorMargin = 14
+
+// The radar shows radarRange world pixels around J0hn in a circle of
+// radarRadius design units
+const radarRange = 1600
+const radarRadius = 60
+const radarImageSize = 128
+
+var powerupColors = map[sim.PowerupType]color.NRGBA{
+	sim.O2Type:   {0x5b, 0x6e, 0xe1, 0xff},
+	sim.FuelType: {0xac, 0x32, 0x32, 0xff},
+}
+var radarPlanetColor = color.NRGBA{0x84, 0x7e, 0x87, 0xff}
+var radarPlayerColor = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+
+// imgWhite is the source of the shapes drawn with DrawTriangles
+var imgWhite *ebiten.Image
+var imgRadar *ebiten.Image
+
+func init() {
+	imgWhite, _ = ebiten.NewImage(3, 3, ebiten.FilterNearest)
+	_ = imgWhite.Fill(color.White)
+	imageAllocated()
+
+	// a dark disc with a ring and a cross, drawn once and scaled
+	img := image.NewNRGBA(image.Rect(0, 0, radarImageSize, radarImageSize))
+	r := radarImageSize / 2.0
+	for y := 0; y < radarImageSize; y++ {
+		for x := 0; x < radarImageSize; x++ {
+			d := math.Hypot(float64(x)+.5-r, float64(y)+.5-r)
+			switch {
+			case d > r:
+			case d > r-2:
+				img.SetNRGBA(x, y, color.NRGBA{0xcb, 0xdb, 0xfc, 0xc0})
+			case x == radarImageSize/2 || y == radarImageSize/2 || math.Abs(d-r/2) < .5:
+				img.SetNRGBA(x, y, color.NRGBA{0xcb, 0xdb, 0xfc, 0x40})
+			default:
+				img.SetNRGBA(x, y, color.NRGBA{0x22, 0x20, 0x34, 0xa0})
+			}
+		}
+	}
+
+	var err error
+	imgRadar, err = ebiten.NewImageFromImage(img, ebiten.FilterLinear)
+	if err != nil {
+		Panic("radar", map[string]interface{}{"image": "radar"}, err)
+	}
+	imageAllocated()
+}
+
+// drawArrow draws a triangle pointing along angle with its tip at tip.
+func drawArrow(screen *ebiten.Image, tip vec2.T, angle, size float64, c color.NRGBA) {
+	sin, cos := math.Sincos(angle)
+	point := func(along, across float64) ebiten.Vertex {
+		return ebiten.Vertex{
+			DstX:   float32(tip[0] + along*cos - across*sin),
+			DstY:   float32(tip[1] + along*sin + across*cos),
+			SrcX:   1,
+			SrcY:   1,
+			ColorR: float32(c.R) / 0xff,
+			ColorG: float32(c.G) / 0xff,
+			ColorB: float32(c.B) / 0xff,
+			ColorA: float32(c.A) / 0xff,
+		}
+	}
+
+	vertices := []ebiten.Vertex{point(0, 0), point(-size, -size/2), point(-size, size/2)}
+	screen.DrawTriangles(vertices, []uint16{0, 1, 2}, imgWhite, nil)
+}
+
+// Radar points to the powerups out of the screen from its edges, and maps
+// planets, powerups and the players around the camera in a corner of the
+// HUD.
+type Radar struct {
+	camera   *sim.Camera
+	planets  *sim.PlanetsSpawner
+	powerups *sim.PowerupsSpawner
+	layout   *HUDLayout
+}
+
+func NewRadar(camera *sim.Camera, planets *sim.PlanetsSpawner, powerups *sim.PowerupsSpawner, layout *HUDLayout) *Radar {
+	return &Radar{
+		camera:   camera,
+		planets:  planets,
+		powerups: powerups,
+		layout:   layout,
+	}
+}
+
+func (r *Radar) Update(_ *ebiten.Image, _ int64) {}
+
+func (r *Radar) Draw(screen *ebiten.Image) {
+	if settings.PowerupArrows {
+		r.drawArrows(screen)
+	}
+	if settings.ShowRadar {
+		r.drawRadar(screen)
+	}
+}
+
+// drawArrows points from the edge of the world view to every powerup out of
+// it and within range, bigger the closer it is.
+func (r *Radar) drawArrows(screen *ebiten.Image) {
+	scale := r.layout.Scale()
+	margin := indicatorMargin * scale
+	min := r.layout.World(vec2.T{0, 0})
+	max := r.layout.World(vec2.T{windowWidth, windowHeight})
+	min.Add(&vec2.T{margin, margin})
+	max.Sub(&vec2.T{margin, margin})
+
+	from := r.layout.World(r.camera.Center())
+	for _, powerup := range sortedPowerups(r.powerups.Active) {
+		world := powerup.Center()
+		if world[0] >= 0 && world[0] <= windowWidth && world[1] >= 0 && world[1] <= windowHeight {
+			continue
+		}
+
+		to := r.layout.World(world)
+		dir := vec2.Sub(&to, &from)
+		distance := dir.Length() / scale
+		if distance > indicatorRange || distance == 0 {
+			continue
+		}
+
+		// the furthest along dir from J0hn that stays inside the margins
+		t := math.Inf(1)
+		for axis := 0; axis < 2; axis++ {
+			if dir[axis] > 0 {
+				t = math.Min(t, (max[axis]-from[axis])/dir[axis])
+			} else if dir[axis] < 0 {
+				t = math.Min(t, (min[axis]-from[axis])/dir[axis])
+			}
+		}
+		tip := dir
+		tip.Scale(t).Add(&from)
+
+		size := indicatorMaxSize - (indicatorMaxSize-indicatorMinSize)*distance/indicatorRange
+		drawArrow(screen, tip, math.Atan2(dir[1], dir[0]), size*scale, powerupColors[powerup.Type])
+	}
+}
+
+// drawRadar maps what is within radarRange of the camera, up is up.
+func (r *Radar) drawRadar(screen *ebiten.Image) {
+	scale := r.layout.Scale()
+	radius := radarRadius * scale
+	corner := r.layout.Place(AnchorTopRight, vec2.T{0, 0}, vec2.T{2 * radius, 2 * radius})
+	middle := vec2.T{corner[0] + radius, corner[1] + radius}
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(2*radius/radarImageSize, 2*radius/radarImageSize)
+	op.GeoM.Translate(corner[0], corner[1])
+	_ = screen.DrawImage(imgRadar, op)
+
+	center := r.camera.Center()
+	blip := func(world vec2.T, size float64, c color.NRGBA) {
+		offset := vec2.Sub(&world, &center)
+		if offset.Length() > radarRange {
+			return
+		}
+
+		offset.Scale(radius / radarRange)
+		size *= scale
+		ebitenutil.DrawRect(screen, math.Round(middle[0]+offset[0]-size/2), math.Round(middle[1]+offset[1]-size/2),
+			math.Round(size), math.Round(size), c)
+	}
+
+	for _, planet := range sortedPlanets(r.planets.Active) {
+		blip(planet.Center(), 6, radarPlanetColor)
+	}
+	for _, powerup := range sortedPowerups(r.powerups.Active) {
+		blip(powerup.Center(), 4, powerupColors[powerup.Type])
+	}
+	for _, player := range r.camera.Players() {
+		c := radarPlayerColor
+		if player.Index > 0 {
+			c = color.NRGBA(playerColors[player.Index])
+		}
+		blip(player.Center(), 4, c)
+	}
+}
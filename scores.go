@@ -0,0 +1,61 @@
+package main
+
+import (
+	"0ms2/sim"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"time"
+)
+
+const scoresFile = "scores.json"
+
+// maxHighScores is how many runs the high score table keeps
+const maxHighScores = 10
+
+// Score is the highest altitude, in km, reached in a run.
+type Score struct {
+	Altitude float64         `json:"altitude"`
+	Physics  sim.PhysicsMode `json:"physics"`
+	Date     time.Time       `json:"date"`
+}
+
+// HighScores are the best runs, highest first.
+type HighScores []Score
+
+func LoadHighScores() HighScores {
+	var scores HighScores
+	if err := loadConfig(scoresFile, &scores); err != nil {
+		log.WithField("file", scoresFile).Warnln("can't load high scores:", err)
+		return nil
+	}
+
+	return scores
+}
+
+// Add records a run and saves the table when it made it in, it returns the
+// rank of the run from 0 or -1 when it didn't.
+func (hs *HighScores) Add(score Score) int {
+	if score.Altitude < 1 {
+		return -1
+	}
+
+	scores := append(*hs, score)
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Altitude > scores[j].Altitude
+	})
+	if len(scores) > maxHighScores {
+		scores = scores[:maxHighScores]
+	}
+	*hs = scores
+
+	for rank, s := range scores {
+		if s == score {
+			if err := saveConfig(scoresFile, scores); err != nil {
+				log.WithField("file", scoresFile).Errorln("can't save high scores:", err)
+			}
+			return rank
+		}
+	}
+
+	return -1
+}
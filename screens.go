@@ -0,0 +1,328 @@
+package main
+
+import (
+	"0ms2/sim"
+	"fmt"
+	"github.com/hajimehoshi/ebiten"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// volumeStep is how much a volume changes per left or right press
+const volumeStep = .1
+
+var textScales = []float64{1, 1.25, 1.5}
+
+func onOff(on bool) string {
+	if on {
+		return T("common.on")
+	}
+	return T("common.off")
+}
+
+func percent(v float64) string {
+	return fmt.Sprintf("%d%%", int(math.Round(v*100)))
+}
+
+// toggle is an item switching a setting on and off.
+func toggle(label string, on *bool) *MenuItem {
+	return &MenuItem{
+		Label: label,
+		Value: func() string { return onOff(*on) },
+		Adjust: func(int) {
+			*on = !*on
+			changed()
+		},
+	}
+}
+
+// changed applies and saves the settings after an item edits them.
+func changed() {
+	settings.Apply()
+	settings.Save()
+}
+
+func (g *Game) mainMenu() *Menu {
+	return NewMenu("game.title",
+		&MenuItem{Label: "menu.play", Activate: g.startRun},
+		&MenuItem{Label: "menu.modes", Activate: func() { g.PushMenu(g.modesMenu()) }},
+		&MenuItem{Label: "menu.high_scores", Activate: func() { g.PushMenu(g.highScoresMenu()) }},
+		&MenuItem{Label: "menu.achievements", Activate: func() { g.PushMenu(g.achievementsMenu()) }},
+		&MenuItem{Label: "menu.settings", Activate: func() { g.PushMenu(g.settingsMenu()) }},
+		&MenuItem{Label: "menu.quit", Activate: g.Quit},
+	)
+}
+
+func (g *Game) pauseMenu() *Menu {
+	return NewMenu("menu.paused",
+		&MenuItem{Label: "menu.resume", Activate: g.Resume},
+		&MenuItem{Label: "menu.restart", Activate: func() { g.finishRun(g.startRun) }},
+		&MenuItem{Label: "menu.settings", Activate: func() { g.PushMenu(g.settingsMenu()) }},
+		&MenuItem{Label: "menu.quit_to_menu", Activate: func() {
+			g.finishRun(func() { g.menus = []*Menu{g.mainMenu()} })
+		}},
+	).SetOnBack(g.Resume)
+}
+
+// resultsMenu sums up the run that just ended, it has to be built before
+// the next run replaces it. next runs on Continue.
+func (g *Game) resultsMenu(next func()) *Menu {
+	best := g.bestAltitude
+	items := []*MenuItem{
+		{Label: "results.altitude", Value: func() string { return FormatDistance(best) }},
+	}
+
+	missions := g.missions.List
+	for _, mission := range missions {
+		mission := mission
+		items = append(items, &MenuItem{
+			Value: func() string {
+				if !mission.Done {
+					return mission.Description() + "  " + T("mission.failed")
+				}
+				return mission.Description() + "  " + T("mission.done")
+			},
+			Hint: mission.RewardDescription,
+		})
+	}
+	if len(missions) > 0 {
+		done := g.missions.Completed()
+		items = append(items, &MenuItem{Value: func() string { return T("results.missions", done, len(missions)) }})
+	}
+	items = append(items, &MenuItem{Label: "menu.continue", Activate: next})
+
+	return NewMenu("results.title", items...).SetOnBack(next)
+}
+
+// modesMenu picks the physics of the next runs, the waiting run is rebuilt
+// with it, how many players fly it and whether they have missions and a
+// ghost.
+func (g *Game) modesMenu() *Menu {
+	item := func(mode sim.PhysicsMode) *MenuItem {
+		return &MenuItem{
+			Label: "physics." + strings.ToLower(mode.String()),
+			Value: func() string {
+				if settings.Physics == mode {
+					return "*"
+				}
+				return ""
+			},
+			Activate: func() {
+				settings.Physics = mode
+				changed()
+				g.newRun(newRunSeed())
+				g.PopMenu()
+			},
+		}
+	}
+
+	return NewMenu("menu.modes",
+		item(sim.PhysicsArcade),
+		item(sim.PhysicsAtmospheric),
+		&MenuItem{
+			Label: "modes.players",
+			Value: func() string { return strconv.Itoa(playerCount()) },
+			Adjust: func(dir int) {
+				settings.Players = (playerCount()-1+dir+maxPlayers)%maxPlayers + 1
+				changed()
+				g.newRun(newRunSeed())
+			},
+		},
+		toggle("modes.missions", &settings.Missions),
+		toggle("modes.ghost", &settings.ShowGhost),
+	).SetOnBack(g.PopMenu)
+}
+
+func (g *Game) highScoresMenu() *Menu {
+	var items []*MenuItem
+	for i, score := range g.scores {
+		i, score := i, score
+		items = append(items, &MenuItem{Value: func() string {
+			return T("scores.entry", i+1, FormatDistance(score.Altitude),
+				T("physics."+strings.ToLower(score.Physics.String())), score.Date.Format(currentFormat().Date))
+		}})
+	}
+	if len(items) == 0 {
+		items = append(items, &MenuItem{Label: "scores.none"})
+	} else {
+		n := len(g.scores)
+		items = append(items, &MenuItem{Value: func() string { return TN("scores.count", n, n) }})
+	}
+	items = append(items, &MenuItem{Label: "menu.back", Activate: g.PopMenu})
+
+	return NewMenu("menu.high_scores", items...).SetOnBack(g.PopMenu)
+}
+
+// achievementsMenu is the gallery, every achievement with how close it is
+// and what it takes.
+func (g *Game) achievementsMenu() *Menu {
+	var items []*MenuItem
+	for _, def := range g.achievements.Defs {
+		def := def
+		items = append(items, &MenuItem{
+			Label: "achievement." + def.ID,
+			Value: func() string {
+				if _, ok := g.achievements.Progress.Unlocked[def.ID]; ok {
+					return T("achievements.unlocked")
+				}
+				return percent(g.achievements.Percent(def))
+			},
+			Hint: func() string { return T("achievement." + def.ID + ".description") },
+		})
+	}
+	items = append(items, &MenuItem{Label: "menu.back", Activate: g.PopMenu})
+
+	return NewMenu("menu.achievements", items...).SetOnBack(g.PopMenu)
+}
+
+func (g *Game) settingsMenu() *Menu {
+	return NewMenu("menu.settings",
+		&MenuItem{Label: "menu.volume", Activate: func() { g.PushMenu(g.volumeMenu()) }},
+		&MenuItem{Label: "menu.controls", Activate: func() { g.PushMenu(g.controlsMenu()) }},
+		&MenuItem{Label: "menu.display", Activate: func() { g.PushMenu(g.displayMenu()) }},
+		&MenuItem{Label: "menu.accessibility", Activate: func() { g.PushMenu(g.accessibilityMenu()) }},
+		&MenuItem{
+			Label: "menu.language",
+			Value: func() string { return T("language.name") },
+			Adjust: func(dir int) {
+				langs := Languages()
+				if len(langs) == 0 {
+					return
+				}
+				i := sort.SearchStrings(langs, settings.Language)
+				settings.Language = langs[(i+dir+len(langs))%len(langs)]
+				changed()
+			},
+		},
+		&MenuItem{
+			Label: "menu.units",
+			Value: func() string {
+				if settings.Units == UnitsImperial {
+					return T("units.imperial")
+				}
+				return T("units.metric")
+			},
+			Adjust: func(int) {
+				settings.Units = 1 - settings.Units
+				changed()
+			},
+		},
+		&MenuItem{Label: "menu.back", Activate: g.PopMenu},
+	).SetOnBack(g.PopMenu)
+}
+
+func (g *Game) volumeMenu() *Menu {
+	item := func(label string, volume *float64) *MenuItem {
+		return &MenuItem{
+			Label: label,
+			Value: func() string { return percent(*volume) },
+			Adjust: func(dir int) {
+				*volume = math.Max(0, math.Min(1, math.Round((*volume+float64(dir)*volumeStep)*10)/10))
+				changed()
+			},
+		}
+	}
+
+	return NewMenu("menu.volume",
+		item("volume.master", &settings.MasterVolume),
+		item("volume.music", &settings.MusicVolume),
+		item("volume.effects", &settings.SfxVolume),
+		&MenuItem{Label: "menu.back", Activate: g.PopMenu},
+	).SetOnBack(g.PopMenu)
+}
+
+func (g *Game) controlsMenu() *Menu {
+	return g.playerControlsMenu(0)
+}
+
+// playerControlsMenu binds the keys of a player, left and right switch to
+// the other players.
+func (g *Game) playerControlsMenu(player int) *Menu {
+	items := []*MenuItem{{
+		Label: "controls.player",
+		Value: func() string { return strconv.Itoa(player + 1) },
+		Adjust: func(dir int) {
+			g.PopMenu()
+			g.PushMenu(g.playerControlsMenu((player + dir + maxPlayers) % maxPlayers))
+		},
+	}}
+	for _, action := range playerActions(player) {
+		action := action
+		items = append(items, &MenuItem{
+			Label: "action." + strings.ToLower(action.String()),
+			Value: func() string { return playerInputs[player].Keys(action)[0].String() },
+			Bind: func(key ebiten.Key) {
+				settings.Bind(player, action, key.String())
+				settings.Save()
+			},
+		})
+	}
+
+	items = append(items,
+		&MenuItem{Label: "controls.reset", Activate: func() {
+			settings.ResetControls(player)
+			changed()
+		}},
+		&MenuItem{Label: "menu.back", Activate: g.PopMenu},
+	)
+
+	return NewMenu("menu.controls", items...).SetOnBack(g.PopMenu)
+}
+
+func (g *Game) displayMenu() *Menu {
+	return NewMenu("menu.display",
+		&MenuItem{
+			Label: "display.window",
+			Value: func() string { return T("display." + strings.ToLower(settings.Display.String())) },
+			Adjust: func(dir int) {
+				n := len(displayModeNames)
+				settings.Display = DisplayMode((int(settings.Display) + dir + n) % n)
+				changed()
+			},
+		},
+		&MenuItem{
+			Label: "display.show_fps",
+			Value: func() string { return onOff(settings.ShowFPS) },
+			Adjust: func(int) {
+				settings.ShowFPS = !settings.ShowFPS
+				changed()
+			},
+		},
+		toggle("display.powerup_arrows", &settings.PowerupArrows),
+		toggle("display.radar", &settings.ShowRadar),
+		&MenuItem{Label: "menu.back", Activate: g.PopMenu},
+	).SetOnBack(g.PopMenu)
+}
+
+func (g *Game) accessibilityMenu() *Menu {
+	return NewMenu("menu.accessibility",
+		&MenuItem{
+			Label: "accessibility.text_size",
+			Value: func() string { return percent(settings.TextScale) },
+			Adjust: func(dir int) {
+				i := 0
+				for i < len(textScales)-1 && textScales[i] < settings.TextScale {
+					i++
+				}
+				i = (i + dir + len(textScales)) % len(textScales)
+				settings.TextScale = textScales[i]
+				changed()
+			},
+		},
+		&MenuItem{
+			Label: "accessibility.reduce_motion",
+			Value: func() string { return onOff(settings.ReduceMotion) },
+			Adjust: func(int) {
+				settings.ReduceMotion = !settings.ReduceMotion
+				changed()
+			},
+		},
+		toggle("accessibility.screen_shake", &settings.ScreenShake),
+		toggle("accessibility.pickup_flash", &settings.PickupFlash),
+		toggle("accessibility.low_o2_vignette", &settings.LowO2Vignette),
+		toggle("accessibility.low_o2_desaturation", &settings.LowO2Desaturation),
+		&MenuItem{Label: "menu.back", Activate: g.PopMenu},
+	).SetOnBack(g.PopMenu)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"0ms2/sim"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// configDirName is the folder under the user config dir the game saves in
+const configDirName = "0ms2"
+const settingsFile = "settings.json"
+
+// rebindableActions are the actions shown in the controls screen, menus keep
+// their fixed keys so they can always be reached.
+var rebindableActions = []Action{ActionThrust, ActionLeft, ActionRight, ActionPause}
+
+// Settings are the player's preferences, saved as JSON whenever they change.
+// Volumes go from 0 to 1.
+type Settings struct {
+	MasterVolume float64 `json:"masterVolume"`
+	MusicVolume  float64 `json:"musicVolume"`
+	SfxVolume    float64 `json:"sfxVolume"`
+
+	// Controls maps action names to the name of the key bound to them, for
+	// player 1. PlayerControls are the flight keys of the co-op players after
+	// him.
+	Controls       map[string]string   `json:"controls"`
+	PlayerControls []map[string]string `json:"playerControls"`
+
+	Display DisplayMode     `json:"display"`
+	ShowFPS bool            `json:"showFps"`
+	Physics sim.PhysicsMode `json:"physics"`
+	// Players is how many fly together, from 1 to maxPlayers
+	Players int `json:"players"`
+	// Missions offers optional goals at every launch
+	Missions bool `json:"missions"`
+	// ShowGhost races the runs against the best one or a loaded ghost
+	ShowGhost bool `json:"showGhost"`
+
+	// PowerupArrows point to the powerups out of the screen, ShowRadar maps
+	// everything around J0hn
+	PowerupArrows bool `json:"powerupArrows"`
+	ShowRadar     bool `json:"showRadar"`
+
+	// Language is the name of a locale file
+	Language string     `json:"language"`
+	Units    UnitSystem `json:"units"`
+
+	// TextScale grows every HUD and menu text
+	TextScale float64 `json:"textScale"`
+	// ReduceMotion drops the fast ambient effects and the screen shake
+	ReduceMotion bool `json:"reduceMotion"`
+
+	// The screen effects, see effects.go
+	ScreenShake       bool `json:"screenShake"`
+	PickupFlash       bool `json:"pickupFlash"`
+	LowO2Vignette     bool `json:"lowO2Vignette"`
+	LowO2Desaturation bool `json:"lowO2Desaturation"`
+}
+
+var settings = DefaultSettings()
+
+func DefaultSettings() *Settings {
+	return &Settings{
+		MasterVolume:  1,
+		MusicVolume:   .7,
+		SfxVolume:     .8,
+		Controls:      make(map[string]string),
+		Display:       defaultDisplayMode,
+		ShowFPS:       true,
+		PowerupArrows: true,
+		Physics:       defaultPhysicsMode,
+		Players:       1,
+		Missions:      true,
+		ShowGhost:     true,
+		Language:      referenceLanguage,
+		TextScale:     1,
+
+		ScreenShake:       true,
+		PickupFlash:       true,
+		LowO2Vignette:     true,
+		LowO2Desaturation: true,
+	}
+}
+
+// configPath returns where name is saved, creating the folder if needed.
+func configPath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir = filepath.Join(dir, configDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, name), nil
+}
+
+// loadConfig reads a JSON file saved by saveConfig into v, a missing file
+// leaves v untouched.
+func loadConfig(name string, v interface{}) error {
+	path, err := configPath(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func saveConfig(name string, v interface{}) error {
+	path, err := configPath(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// LoadSettings returns the saved settings, or the defaults when there are
+// none or they can't be read.
+func LoadSettings() *Settings {
+	s := DefaultSettings()
+	if err := loadConfig(settingsFile, s); err != nil {
+		log.WithField("file", settingsFile).Warnln("can't load settings:", err)
+		return DefaultSettings()
+	}
+
+	if s.TextScale <= 0 {
+		s.TextScale = 1
+	}
+	if s.Controls == nil {
+		s.Controls = make(map[string]string)
+	}
+	if s.Display < DisplayFixed || s.Display > DisplayFullscreen {
+		s.Display = defaultDisplayMode
+	}
+
+	return s
+}
+
+func (s *Settings) Save() {
+	if err := saveConfig(settingsFile, s); err != nil {
+		log.WithField("file", settingsFile).Errorln("can't save settings:", err)
+	}
+}
+
+// controls are the keys saved for player, from 0, nil when there are none.
+func (s *Settings) controls(player int) map[string]string {
+	if player == 0 {
+		return s.Controls
+	}
+	if player <= len(s.PlayerControls) {
+		return s.PlayerControls[player-1]
+	}
+	return nil
+}
+
+// Bind changes the key of action for player and remembers it.
+func (s *Settings) Bind(player int, action Action, key string) {
+	for len(s.PlayerControls) < player {
+		s.PlayerControls = append(s.PlayerControls, nil)
+	}
+	if s.controls(player) == nil {
+		s.PlayerControls[player-1] = make(map[string]string)
+	}
+
+	s.controls(player)[action.String()] = key
+	s.Apply()
+}
+
+// ResetControls forgets the keys player bound.
+func (s *Settings) ResetControls(player int) {
+	if player == 0 {
+		s.Controls = make(map[string]string)
+	} else if player <= len(s.PlayerControls) {
+		s.PlayerControls[player-1] = nil
+	}
+}
+
+// Apply pushes the settings to the window, the input and the game. The
+// physics mode only changes on the next run.
+func (s *Settings) Apply() {
+	SetLanguage(s.Language)
+
+	for player, in := range playerInputs {
+		in.ResetBindings()
+		for _, action := range playerActions(player) {
+			if name, ok := s.controls(player)[action.String()]; ok {
+				if key, ok := KeyByName(name); ok {
+					in.Bind(action, key)
+				} else {
+					log.WithField("key", name).Warnln("unknown key bound to", action)
+				}
+			}
+		}
+	}
+
+	if game != nil {
+		game.ShowFPS = s.ShowFPS
+		game.SetDisplayMode(s.Display)
+	}
+}
@@ -0,0 +1,96 @@
+package sim
+
+// AmbientEffect is the decoration an atmosphere zone spawns around the player.
+type AmbientEffect int
+
+const (
+	AmbientNone AmbientEffect = iota
+	AmbientClouds
+	AmbientHaze
+	AmbientMeteors
+	AmbientAurora
+	AmbientSolarWind
+)
+
+// zoneBlendFraction is the top part of every zone that fades into the next.
+const zoneBlendFraction = .2
+
+// zoneStretch turns the real floors of the zones into game km. A run climbs
+// thousands of km, at the real floors the troposphere would be gone 40 pixels
+// after lift-off and the zones up to the exosphere would all pass in the
+// first seconds. Stretched 12.5 times the exosphere starts at 7500 km, still
+// below deep space
+const zoneStretch = 12.5
+
+// AtmosphereZone is a named altitude band. Sky is a CSS gradient running from
+// the zone floor (0%) to its ceiling (100%), chaining each zone's last colour
+// to the next zone's first one keeps the sky seamless.
+type AtmosphereZone struct {
+	Name  string
+	Floor float64
+	Sky   string
+	// StarDensity scales the star field, 1 is the full deep space density
+	StarDensity float64
+	// Drag is the share of velocity kept on every tick
+	Drag float64
+	// O2Drain scales how fast J0hn breathes his oxygen
+	O2Drain float64
+	Ambient AmbientEffect
+}
+
+// AtmosphereZones are sorted by floor, altitudes are in km as shown on the HUD.
+// Every floor but deep space is stretched by zoneStretch. Deep space stays at
+// 10000 km, where gravity and the air are gone, stretched it would be out of
+// reach of any run.
+var AtmosphereZones = []*AtmosphereZone{
+	{Name: "Troposphere", Floor: 0, Sky: "linear-gradient(to top in oklab, #cbdbfc, #639bff)", StarDensity: 0, Drag: frictionFactor, O2Drain: 1, Ambient: AmbientClouds},
+	{Name: "Stratosphere", Floor: 12 * zoneStretch, Sky: "linear-gradient(to top in oklab, #639bff, #5b6ee1)", StarDensity: 0, Drag: .992, O2Drain: 1.1, Ambient: AmbientHaze},
+	{Name: "Mesosphere", Floor: 50 * zoneStretch, Sky: "linear-gradient(to top in oklab, #5b6ee1, #3f3f74)", StarDensity: .15, Drag: .995, O2Drain: 1.25, Ambient: AmbientMeteors},
+	{Name: "Thermosphere", Floor: 85 * zoneStretch, Sky: "linear-gradient(to top in oklab, #3f3f74, #222034)", StarDensity: .5, Drag: .998, O2Drain: 1.5, Ambient: AmbientAurora},
+	{Name: "Exosphere", Floor: 600 * zoneStretch, Sky: "linear-gradient(to top in oklab, #222034, black)", StarDensity: .85, Drag: .9995, O2Drain: 1.75, Ambient: AmbientSolarWind},
+	{Name: "Deep space", Floor: 10000, Sky: "linear-gradient(black, black)", StarDensity: 1, Drag: 1, O2Drain: 2, Ambient: AmbientNone},
+}
+
+// AtmosphereAt returns the zone containing altitude, the zone above it (nil
+// in deep space) and how far altitude has blended into it, from 0 to 1.
+func AtmosphereAt(altitude float64) (zone, next *AtmosphereZone, blend float64) {
+	i := 0
+	for i+1 < len(AtmosphereZones) && altitude >= AtmosphereZones[i+1].Floor {
+		i++
+	}
+
+	zone = AtmosphereZones[i]
+	if i+1 == len(AtmosphereZones) {
+		return zone, nil, 0
+	}
+
+	next = AtmosphereZones[i+1]
+	span := next.Floor - zone.Floor
+	start := next.Floor - span*zoneBlendFraction
+	if altitude > start {
+		blend = smoothStep((altitude - start) / (span * zoneBlendFraction))
+	}
+
+	return zone, next, blend
+}
+
+func atmosphereMix(altitude float64, property func(*AtmosphereZone) float64) float64 {
+	zone, next, blend := AtmosphereAt(altitude)
+	if next == nil {
+		return property(zone)
+	}
+
+	return lerp(property(zone), property(next), blend)
+}
+
+func StarDensityAt(altitude float64) float64 {
+	return atmosphereMix(altitude, func(z *AtmosphereZone) float64 { return z.StarDensity })
+}
+
+func DragAt(altitude float64) float64 {
+	return atmosphereMix(altitude, func(z *AtmosphereZone) float64 { return z.Drag })
+}
+
+func O2DrainAt(altitude float64) float64 {
+	return atmosphereMix(altitude, func(z *AtmosphereZone) float64 { return z.O2Drain })
+}
@@ -0,0 +1,203 @@
+package sim
+
+import (
+	"github.com/ungerik/go3d/float64/vec2"
+)
+
+// The camera catches up with the middle of the players by cameraFollow of
+// the way every tick, so it doesn't jump when one of them lifts off
+const cameraFollow = .2
+
+// cameraMargin is how close to the edges of the world, in world pixels, a
+// flying J0hn can get before the camera holds him back
+const cameraMargin = 16
+
+// Camera is what the world scrolls with. Everything that used to follow J0hn
+// follows it: its Velocity scrolls the sky and RelativePosition is its
+// altitude and drift, in km, both like J0hn's.
+//
+// It frames the middle of the flying players, or of all of them while none
+// flies. Every J0hn is drawn off his standing spot by the km between him and
+// the camera, and the flying ones are kept on the screen. With a single
+// player the camera is J0hn, so he stays where he stands.
+type Camera struct {
+	players []*J0hn
+	// stands are where each player stands on the platform, in J0hn units
+	stands []vec2.T
+
+	RelativePosition *vec2.T
+	Velocity         *vec2.T
+	// Position is the middle of the framed players on the screen, in J0hn
+	// units like J0hn.Position
+	Position  *vec2.T
+	Flying    bool
+	IsLifting bool
+	// tracked is where another camera is, in km, followed instead of the
+	// players when set
+	tracked *vec2.T
+
+	timeAccumulator float64
+}
+
+func NewCamera(players ...*J0hn) *Camera {
+	c := &Camera{
+		players:          players,
+		RelativePosition: new(vec2.T),
+		Velocity:         new(vec2.T),
+		Position:         new(vec2.T),
+	}
+	for _, p := range players {
+		c.stands = append(c.stands, *p.UpPosition)
+	}
+	c.frame()
+
+	return c
+}
+
+// Track makes the camera follow position, the camera of a race server,
+// rather than the players.
+func (c *Camera) Track(position *vec2.T) *Camera {
+	c.tracked = position
+	return c
+}
+
+// Players are the J0hns of the run, player 1 first.
+func (c *Camera) Players() []*J0hn {
+	return c.players
+}
+
+// framed are the players the camera follows.
+func (c *Camera) framed() []*J0hn {
+	var flying []*J0hn
+	for _, p := range c.players {
+		if p.Flying || p.IsLifting {
+			flying = append(flying, p)
+		}
+	}
+	if len(flying) == 0 {
+		return c.players
+	}
+	return flying
+}
+
+// target is the middle of the framed players, in km, or the tracked camera.
+func (c *Camera) target() vec2.T {
+	if c.tracked != nil {
+		return *c.tracked
+	}
+
+	framed := c.framed()
+	target := vec2.T{}
+	for _, p := range framed {
+		target.Add(p.RelativePosition)
+	}
+	return *target.Scale(1 / float64(len(framed)))
+}
+
+// Reset puts the camera on its target right away, after the players were
+// moved rather than flown.
+func (c *Camera) Reset() {
+	*c.RelativePosition = c.target()
+	*c.Velocity = vec2.T{}
+	c.place()
+	c.frame()
+}
+
+// Update runs the ticks delta ms hold.
+func (c *Camera) Update(delta int64) {
+	c.timeAccumulator += float64(delta)
+
+	for c.timeAccumulator >= Tick {
+		c.timeAccumulator -= Tick
+		c.tick()
+	}
+
+	c.frame()
+}
+
+// Step runs one tick of the camera right away, for cameras simulated outside
+// of the game loop.
+func (c *Camera) Step() {
+	c.tick()
+	c.frame()
+}
+
+func (c *Camera) tick() {
+	last := *c.RelativePosition
+	target := c.target()
+	if len(c.players) == 1 || c.tracked != nil {
+		*c.RelativePosition = target
+	} else {
+		target.Sub(&last).Scale(cameraFollow)
+		c.RelativePosition.Add(&target)
+	}
+
+	// the same scroll J0hn's velocity gives over a tick
+	moved := *c.RelativePosition
+	moved.Sub(&last).Scale(1000 / float64(Tick))
+	*c.Velocity = moved
+
+	c.place()
+}
+
+// place moves every J0hn to where he is from the camera, the flying ones
+// held within cameraMargin of the edges.
+func (c *Camera) place() {
+	min := vec2.T{cameraMargin / float64(J0hnScale), cameraMargin / float64(J0hnScale)}
+	max := vec2.T{
+		float64(ScreenWidth-cameraMargin)/J0hnScale - PlayerSize,
+		float64(ScreenHeight-cameraMargin)/J0hnScale - PlayerSize,
+	}
+
+	for i, p := range c.players {
+		offset := *c.RelativePosition
+		offset.Sub(p.RelativePosition).Scale(PixelsPerKm / J0hnScale)
+		up := c.stands[i]
+		up.Add(&offset)
+
+		if p.Flying {
+			for axis := 0; axis < 2; axis++ {
+				switch {
+				case up[axis] < min[axis]:
+					up[axis] = min[axis]
+					if p.Velocity[axis] > 0 {
+						p.Velocity[axis] = 0
+					}
+				case up[axis] > max[axis]:
+					up[axis] = max[axis]
+					if p.Velocity[axis] < 0 {
+						p.Velocity[axis] = 0
+					}
+				default:
+					continue
+				}
+				p.RelativePosition[axis] = c.RelativePosition[axis] - (up[axis]-c.stands[i][axis])*J0hnScale/PixelsPerKm
+			}
+		}
+
+		shift := up
+		shift.Sub(p.UpPosition)
+		p.UpPosition.Add(&shift)
+		p.Position.Add(&shift)
+	}
+}
+
+// frame gathers the state of the framed players the world follows.
+func (c *Camera) frame() {
+	framed := c.framed()
+	position := vec2.T{}
+	c.Flying, c.IsLifting = false, false
+	for _, p := range framed {
+		position.Add(p.Position)
+		c.Flying = c.Flying || p.Flying
+		c.IsLifting = c.IsLifting || p.IsLifting
+	}
+	*c.Position = *position.Scale(1 / float64(len(framed)))
+}
+
+// Center is the middle of the framed players, in world pixels.
+func (c *Camera) Center() vec2.T {
+	center := *c.Position
+	center.Scale(J0hnScale).Add(&vec2.T{PlayerSize * J0hnScale / 2, PlayerSize * J0hnScale / 2})
+	return center
+}
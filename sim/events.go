@@ -0,0 +1,46 @@
+package sim
+
+// EventKind is something that happened in a run.
+type EventKind int
+
+const (
+	// EventLaunch is J0hn lifting off the platform
+	EventLaunch EventKind = iota
+	// EventThrust is J0hn starting to thrust, not every tick he keeps at it
+	EventThrust
+	// EventPickup is a powerup collected, of Event.Powerup type
+	EventPickup
+	// EventRunEnd is a run being over, Event.Altitude is the best it got
+	EventRunEnd
+	// EventImpact is J0hn hitting something at Event.Speed
+	EventImpact
+)
+
+// Event is what gameplay code tells the rest of the game about. Player is
+// the J0hn it happened to, nil for the run events.
+type Event struct {
+	Kind     EventKind
+	Player   *J0hn
+	Powerup  PowerupType
+	Altitude float64
+	Speed    float64
+}
+
+// EventBus hands events to every subscriber, in the order they subscribed.
+type EventBus struct {
+	handlers []func(Event)
+}
+
+func (b *EventBus) Subscribe(handler func(Event)) {
+	b.handlers = append(b.handlers, handler)
+}
+
+// Emit hands e to the subscribers, a nil bus drops it.
+func (b *EventBus) Emit(e Event) {
+	if b == nil {
+		return
+	}
+	for _, handler := range b.handlers {
+		handler(e)
+	}
+}
@@ -0,0 +1,26 @@
+package sim
+
+import (
+	"github.com/ungerik/go3d/float64/vec2"
+	"math"
+)
+
+func copyVector(src vec2.T) vec2.T {
+	var dest [2]float64
+	dest[0] = src[0]
+	dest[1] = src[1]
+
+	return vec2.T(dest)
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+func smoothStep(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,371 @@
+package sim
+
+import (
+	"github.com/ungerik/go3d/float64/vec2"
+	"math"
+)
+
+//type PlayerDirection float64
+
+// Tick is a physics tick, in ms
+const Tick = (1 / 60.0) * 1000
+
+// frictionFactor is the drag near the ground, see AtmosphereZones and physics.go
+// for the rest
+const frictionFactor = 0.99
+const frameTime = 100
+
+/*const (
+	DirectionLeft PlayerDirection = iota - 1
+	DirectionTop
+	DirectionRight
+)*/
+
+var leftOffsetRotation = vec2.T{-10, 32}
+var rightOffsetRotation = vec2.T{28, -13}
+
+// Keys are the flight keys held down during a tick.
+type Keys struct {
+	Thrust, Left, Right bool
+}
+
+// Controls fly a J0hn, Held is what they hold down on the tick.
+type Controls interface {
+	Held() Keys
+}
+
+// Held makes keys pressed from elsewhere fly a J0hn, the keys of network
+// pilots.
+func (k *Keys) Held() Keys {
+	return *k
+}
+
+type J0hn struct {
+	//direction        PlayerDirection
+	Rotation         float64
+	Position         *vec2.T
+	Acceleration     *vec2.T
+	Velocity         *vec2.T
+	RelativePosition *vec2.T
+	UpPosition       *vec2.T
+	AnimationFrame   int
+	IsAccelerating   bool
+	timeAcumulator   float64
+	collitionBox     vec2.Rect
+	frameStep        int64
+	IsLifting        bool
+
+	O2, Fuel float64
+
+	Flying  bool
+	Physics PhysicsMode
+	tuning  *Tuning
+	// god keeps o2 and fuel from draining
+	god bool
+
+	// Index is the player J0hn is, from 0, controls what flies him, nothing
+	// while nil
+	Index    int
+	controls Controls
+	// bus gets his events
+	bus *EventBus
+}
+
+func NewJ0hn() *J0hn {
+	return &J0hn{
+		Position:         new(vec2.T),
+		Acceleration:     new(vec2.T),
+		Velocity:         new(vec2.T),
+		RelativePosition: new(vec2.T),
+		Fuel:             100,
+		O2:               100,
+		tuning:           DefaultTuning(),
+	}
+}
+
+func (j0hn *J0hn) SetPosition(newPosition vec2.T) *J0hn {
+	scrPosition := copyVector(newPosition)
+	scrPosition.Scale(1 / J0hnScale)
+	scrPosition[0], scrPosition[1] = math.Round(scrPosition[0]), math.Round(scrPosition[1])
+	j0hn.UpPosition = &scrPosition
+
+	t := copyVector(scrPosition)
+	j0hn.Position = &t
+	return j0hn
+}
+
+// SetPlayer makes J0hn the index-th player.
+func (j0hn *J0hn) SetPlayer(index int) *J0hn {
+	j0hn.Index = index
+	return j0hn
+}
+
+// SetControls flies J0hn with controls.
+func (j0hn *J0hn) SetControls(controls Controls) *J0hn {
+	j0hn.controls = controls
+	return j0hn
+}
+
+// SetEvents makes J0hn tell bus what happens to him, he tells nobody until
+// then.
+func (j0hn *J0hn) SetEvents(bus *EventBus) *J0hn {
+	j0hn.bus = bus
+	return j0hn
+}
+
+func (j0hn *J0hn) SetPhysicsMode(mode PhysicsMode) *J0hn {
+	j0hn.Physics = mode
+	return j0hn
+}
+
+// SetTuning flies J0hn with t rather than the default tuning.
+func (j0hn *J0hn) SetTuning(t *Tuning) *J0hn {
+	j0hn.tuning = t
+	return j0hn
+}
+
+func (j0hn *J0hn) SetGodMode(on bool) *J0hn {
+	j0hn.god = on
+	return j0hn
+}
+
+func (j0hn *J0hn) Accelerate(amount *vec2.T) *J0hn {
+	j0hn.Flying = true
+	j0hn.Acceleration.Add(amount)
+	if !j0hn.IsAccelerating {
+		j0hn.bus.Emit(Event{Kind: EventThrust, Player: j0hn})
+	}
+	j0hn.IsAccelerating = true
+
+	if j0hn.Velocity[0] > 50 || j0hn.Velocity[0] < -50 {
+		j0hn.Acceleration[0] = 0
+	}
+
+	if j0hn.Velocity[1] > 50 || j0hn.Velocity[1] < -50 {
+		j0hn.Acceleration[1] = 0
+	}
+
+	j0hn.Velocity.Add(j0hn.Acceleration)
+
+	return j0hn
+}
+
+func (j0hn *J0hn) Steady() *J0hn {
+	j0hn.Acceleration = new(vec2.T)
+	j0hn.IsAccelerating = false
+	j0hn.AnimationFrame = 1
+
+	/*
+		if j0hn.velocity.Length() < .5 {
+			if j0hn.velocity[0] > j0hn.velocity[1] {
+
+			}
+		}*/
+
+	//fmt.Printf("%#v\n", j0hn.velocity)
+
+	return j0hn
+}
+
+func (j0hn *J0hn) StandUp() *J0hn {
+	j0hn.Velocity = new(vec2.T)
+	j0hn.Acceleration = new(vec2.T)
+	j0hn.IsAccelerating = false
+	j0hn.AnimationFrame = 0
+
+	return j0hn
+}
+
+// Update runs the ticks delta ms hold.
+func (j0hn *J0hn) Update(delta int64) {
+	j0hn.animate(delta)
+
+	j0hn.timeAcumulator += float64(delta)
+	for j0hn.timeAcumulator >= Tick {
+		j0hn.timeAcumulator -= Tick
+		j0hn.tick()
+	}
+}
+
+// animate turns the jetpack flames over while J0hn thrusts.
+func (j0hn *J0hn) animate(delta int64) {
+	j0hn.frameStep += delta
+
+	if j0hn.IsAccelerating && j0hn.Fuel > 0 && j0hn.frameStep >= frameTime {
+		j0hn.frameStep = 0
+		j0hn.AnimationFrame++
+		if j0hn.AnimationFrame == 8 {
+			j0hn.AnimationFrame -= 6
+		}
+	}
+}
+
+// tick runs one physics tick of J0hn.
+func (j0hn *J0hn) tick() {
+	var keys Keys
+	if j0hn.controls != nil {
+		keys = j0hn.controls.Held()
+	}
+
+	gravity := 0.0
+	if j0hn.IsLifting {
+		j0hn.Velocity = &vec2.T{0, 200}
+	} else {
+		var direction = 0.0
+
+		if j0hn.Flying && !j0hn.god {
+			j0hn.O2 -= float64(Tick) / 500 * O2DrainAt(j0hn.RelativePosition[1])
+			if j0hn.O2 < 0 {
+				j0hn.O2 = 0
+				j0hn.Velocity = new(vec2.T)
+			}
+
+			if keys.Right {
+				direction = -1
+				np := copyVector(*j0hn.UpPosition)
+				np.Add(&rightOffsetRotation)
+				*j0hn.Position = np
+			} else if keys.Left {
+				direction = 1
+				np := copyVector(*j0hn.UpPosition)
+				np.Add(&leftOffsetRotation)
+				*j0hn.Position = np
+			} else {
+				*j0hn.Position = *j0hn.UpPosition
+			}
+			j0hn.Rotation = -direction * ((45 * math.Pi) / 180)
+
+			PlayerLog.WithField("position", *j0hn.Position).Trace("")
+		}
+
+		if keys.Thrust && j0hn.Fuel > 0 && j0hn.O2 > 0 {
+			amount := vec2.T{}
+			if !j0hn.Flying {
+				j0hn.IsLifting = true
+				j0hn.bus.Emit(Event{Kind: EventLaunch, Player: j0hn})
+			} else {
+				amount = vec2.T{direction, 1}
+			}
+			amount.Scale(1 / float64(Tick))
+			j0hn.Accelerate(&amount)
+
+			if j0hn.Fuel < 0 {
+				j0hn.Fuel = 0
+			} else if j0hn.Fuel > 0 && !j0hn.IsLifting && !j0hn.god {
+				j0hn.Fuel -= float64(Tick) / 100
+			}
+		} else if !j0hn.Flying {
+			j0hn.StandUp()
+		} else {
+			j0hn.Steady()
+		}
+
+		if j0hn.Flying {
+			gravity = j0hn.Physics.Gravity(j0hn.RelativePosition[1], j0hn.tuning)
+			j0hn.Velocity[1] -= gravity
+		}
+		j0hn.Velocity.Scale(j0hn.Physics.Drag(j0hn.RelativePosition[1], j0hn.tuning))
+	}
+
+	// drag alone never quite stops J0hn so slow velocities are dropped,
+	// but under gravity a slow J0hn is one starting to fall
+	if math.IsNaN(j0hn.Velocity[0]) || (j0hn.Velocity[0] < 1 && j0hn.Velocity[0] > -1) {
+		j0hn.Velocity[0] = 0
+	}
+
+	if math.IsNaN(j0hn.Velocity[1]) || (gravity == 0 && j0hn.Velocity[1] < 1 && j0hn.Velocity[1] > -1) {
+		j0hn.Velocity[1] = 0
+	}
+
+	v := copyVector(*j0hn.Velocity)
+	v.Scale(float64(Tick) / 1000)
+	j0hn.RelativePosition = j0hn.RelativePosition.Add(&v)
+
+	// falling back, J0hn lands where he took off
+	if j0hn.RelativePosition[1] < 0 {
+		j0hn.RelativePosition[1] = 0
+		if j0hn.Velocity[1] < 0 {
+			j0hn.bus.Emit(Event{Kind: EventImpact, Player: j0hn, Speed: -j0hn.Velocity[1]})
+			j0hn.Velocity[1] = 0
+		}
+	}
+
+	// the whole lift-off sky went below the top of the screen
+	if j0hn.IsLifting && j0hn.RelativePosition[1] > LiftOffAltitude {
+		j0hn.IsLifting = false
+	}
+}
+
+// Step runs one physics tick of J0hn right away, for J0hns simulated outside
+// of the game loop.
+func (j0hn *J0hn) Step() {
+	j0hn.animate(netTick)
+	j0hn.tick()
+}
+
+func (j0hn *J0hn) AddO2(amount float64) {
+	total := j0hn.O2 + amount
+	if total > 100 {
+		total = 100
+	}
+
+	j0hn.O2 = total
+}
+
+func (j0hn *J0hn) AddFuel(amount float64) {
+	total := j0hn.Fuel + amount
+	if total > 100 {
+		total = 100
+	}
+
+	j0hn.Fuel = total
+}
+
+// Nozzle returns where on the screen a point of the sprite, a jetpack nozzle,
+// is and the direction it points to, after J0hn's rotation.
+func (j0hn *J0hn) Nozzle(local vec2.T) (vec2.T, float64) {
+	sin, cos := math.Sincos(j0hn.Rotation)
+	position := vec2.T{
+		(local[0]*cos - local[1]*sin + j0hn.Position[0]) * J0hnScale,
+		(local[0]*sin + local[1]*cos + j0hn.Position[1]) * J0hnScale,
+	}
+
+	return position, math.Pi/2 + j0hn.Rotation
+}
+
+// CollitionBox returns the area of the screen J0hn collides with.
+func (j0hn *J0hn) CollitionBox() vec2.Rect {
+	position := copyVector(*j0hn.UpPosition)
+	position.Scale(J0hnScale)
+	max := copyVector(position)
+	max.Add(&vec2.T{PlayerSize * J0hnScale, PlayerSize * J0hnScale})
+
+	position.Add(&vec2.T{(PlayerSize * J0hnScale) / 4, 0})
+	max.Sub(&vec2.T{(PlayerSize * J0hnScale) / 4, 0})
+
+	return vec2.Rect{
+		Min: position,
+		Max: max,
+	}
+}
+
+// Center is the middle of J0hn's collision box, in world pixels.
+func (j0hn *J0hn) Center() vec2.T {
+	box := j0hn.CollitionBox()
+	return vec2.T{(box.Min[0] + box.Max[0]) / 2, (box.Min[1] + box.Max[1]) / 2}
+}
+
+func (j0hn *J0hn) Collition(obj *vec2.Rect) bool {
+	playerArea := j0hn.CollitionBox()
+	j0hn.collitionBox = playerArea
+
+	PlayerLog.WithFields(map[string]interface{}{
+		"player": playerArea,
+		"obj":    obj,
+	}).Trace("")
+
+	return playerArea.ContainsPoint(&obj.Min) ||
+		playerArea.ContainsPoint(&obj.Max) ||
+		playerArea.ContainsPoint(&vec2.T{obj.Min[0], obj.Max[1]}) ||
+		playerArea.ContainsPoint(&vec2.T{obj.Max[0], obj.Min[1]})
+}
@@ -0,0 +1,14 @@
+package sim
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// The loggers of the simulation log through the standard logrus logger
+// until the game points them at its subsystem loggers
+var (
+	PlayerLog   = log.WithField("subsystem", "player")
+	PlanetsLog  = log.WithField("subsystem", "planets")
+	PowerupsLog = log.WithField("subsystem", "powerups")
+	NetLog      = log.WithField("subsystem", "net")
+)
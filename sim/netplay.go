@@ -0,0 +1,202 @@
+package sim
+
+import (
+	"encoding/json"
+	"github.com/ungerik/go3d/float64/vec2"
+	"net"
+)
+
+// netVersion is the race protocol, servers refuse pilots of another version
+const netVersion = 1
+
+// RaceDefaultAddr is where race servers listen by default
+const RaceDefaultAddr = ":7457"
+
+// DefaultPilotName is who a pilot races as without a name of his own
+const DefaultPilotName = "J0hn"
+
+// netTick is a physics tick rounded up to whole ms, the server and the
+// pilots step J0hn once every netTick. Everything steps by one Tick then,
+// not by netTick ms, or the rounding would add a tick every 50
+const netTick = 17
+
+// The server sends a snapshot every snapshotEvery ticks, pilots show the
+// others netInterpTicks behind the last snapshot so they always have two
+// snapshots to move them between
+const snapshotEvery = 3
+const netInterpTicks = 2 * snapshotEvery
+
+// NetMessage is what the server and the pilots send each other, a JSON
+// object per message with one of its fields set.
+type NetMessage struct {
+	Hello    *NetHello    `json:"hello,omitempty"`
+	Race     *NetRace     `json:"race,omitempty"`
+	Input    *NetInput    `json:"input,omitempty"`
+	Snapshot *NetSnapshot `json:"snapshot,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// NetHello is the first message of a pilot.
+type NetHello struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+// NetRace starts a race. Every pilot builds the run from Seed and Physics
+// with a J0hn for each of Pilots, You is the one of the pilot it's sent to.
+type NetRace struct {
+	Seed    int64       `json:"seed"`
+	Physics PhysicsMode `json:"physics"`
+	Pilots  []string    `json:"pilots"`
+	You     int         `json:"you"`
+}
+
+// NetInput is what a pilot held during a tick, Seq counts his ticks.
+type NetInput struct {
+	Seq    int64 `json:"seq"`
+	Thrust bool  `json:"thrust,omitempty"`
+	Left   bool  `json:"left,omitempty"`
+	Right  bool  `json:"right,omitempty"`
+}
+
+// keys are the keys the input holds down.
+func (i NetInput) keys() Keys {
+	return Keys{Thrust: i.Thrust, Left: i.Left, Right: i.Right}
+}
+
+// NetSnapshot is the race at Tick. Ack is the last input of the pilot it's
+// sent to the server used. Camera is where the camera of the server is, in
+// km, the planets and powerups are placed on its screen. Pickups are the
+// powerups collected since the last snapshot, Over is set once the race is
+// over.
+type NetSnapshot struct {
+	Tick     int64       `json:"tick"`
+	Ack      int64       `json:"ack"`
+	Camera   vec2.T      `json:"camera"`
+	Pilots   []NetPilot  `json:"pilots"`
+	Planets  []NetBody   `json:"planets"`
+	Powerups []NetBody   `json:"powerups"`
+	Pickups  []NetPickup `json:"pickups,omitempty"`
+	Over     bool        `json:"over,omitempty"`
+}
+
+// NetPilot is the state of a J0hn. Position, Velocity and Acceleration are
+// in km like his, Offset is how tilting shifted his sprite. Gone pilots left
+// the server.
+type NetPilot struct {
+	Position     vec2.T  `json:"p"`
+	Velocity     vec2.T  `json:"v"`
+	Acceleration vec2.T  `json:"a"`
+	Offset       vec2.T  `json:"o"`
+	Rotation     float64 `json:"r"`
+	Frame        int     `json:"f"`
+	O2           float64 `json:"o2"`
+	Fuel         float64 `json:"fuel"`
+	Flying       bool    `json:"flying,omitempty"`
+	Lifting      bool    `json:"lifting,omitempty"`
+	Thrusting    bool    `json:"thrusting,omitempty"`
+	Gone         bool    `json:"gone,omitempty"`
+}
+
+func pilotState(j0hn *J0hn) NetPilot {
+	offset := *j0hn.Position
+	offset.Sub(j0hn.UpPosition)
+
+	return NetPilot{
+		Position:     *j0hn.RelativePosition,
+		Velocity:     *j0hn.Velocity,
+		Acceleration: *j0hn.Acceleration,
+		Offset:       offset,
+		Rotation:     j0hn.Rotation,
+		Frame:        j0hn.AnimationFrame,
+		O2:           j0hn.O2,
+		Fuel:         j0hn.Fuel,
+		Flying:       j0hn.Flying,
+		Lifting:      j0hn.IsLifting,
+		Thrusting:    j0hn.IsAccelerating,
+	}
+}
+
+// apply puts J0hn in the state, where he stands on the screen is left to the
+// camera.
+func (s NetPilot) apply(j0hn *J0hn) {
+	*j0hn.RelativePosition = s.Position
+	*j0hn.Velocity = s.Velocity
+	*j0hn.Acceleration = s.Acceleration
+	*j0hn.Position = *j0hn.UpPosition
+	j0hn.Position.Add(&s.Offset)
+	j0hn.Rotation = s.Rotation
+	j0hn.AnimationFrame = s.Frame
+	j0hn.O2 = s.O2
+	j0hn.Fuel = s.Fuel
+	j0hn.Flying = s.Flying
+	j0hn.IsLifting = s.Lifting
+	j0hn.IsAccelerating = s.Thrusting
+}
+
+// lerpPilot is the state f of the way from a to b, only the position moves
+// smoothly.
+func lerpPilot(a, b NetPilot, f float64) NetPilot {
+	b.Position = lerpVector(a.Position, b.Position, f)
+	return b
+}
+
+func lerpVector(a, b vec2.T, f float64) vec2.T {
+	return vec2.T{lerp(a[0], b[0], f), lerp(a[1], b[1], f)}
+}
+
+// NetBody is a planet or a powerup, at its position in the spawner. Sprite
+// is the planet sprite, Type the powerup type.
+type NetBody struct {
+	ID       uint        `json:"id"`
+	Position vec2.T      `json:"p"`
+	Sprite   int         `json:"s,omitempty"`
+	Type     PowerupType `json:"t,omitempty"`
+}
+
+// bodyAt is where body is f of the way from where it was in from, bodies
+// new in the snapshot don't move.
+func bodyAt(from []NetBody, body NetBody, f float64) vec2.T {
+	for _, old := range from {
+		if old.ID == body.ID {
+			return lerpVector(old.Position, body.Position, f)
+		}
+	}
+	return body.Position
+}
+
+// NetPickup is a powerup of Type the J0hn of Pilot collected.
+type NetPickup struct {
+	Pilot int         `json:"pilot"`
+	Type  PowerupType `json:"type"`
+}
+
+// netConn sends and receives NetMessages over a connection, one message per
+// line.
+type netConn struct {
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+}
+
+func newNetConn(conn net.Conn) *netConn {
+	return &netConn{
+		conn: conn,
+		enc:  json.NewEncoder(conn),
+		dec:  json.NewDecoder(conn),
+	}
+}
+
+func (c *netConn) Send(m NetMessage) error {
+	return c.enc.Encode(m)
+}
+
+func (c *netConn) Receive() (NetMessage, error) {
+	var m NetMessage
+	err := c.dec.Decode(&m)
+	return m, err
+}
+
+func (c *netConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,76 @@
+package sim
+
+import "math"
+
+// PhysicsMode decides how the air and the planet act on J0hn.
+type PhysicsMode int
+
+const (
+	// PhysicsArcade has no gravity, drag comes from the atmosphere zones
+	PhysicsArcade PhysicsMode = iota
+	// PhysicsAtmospheric pulls J0hn down and slows him with the drag of the
+	// zones thinned by the air density, both fade with altitude until they
+	// vanish in deep space
+	PhysicsAtmospheric
+)
+
+const earthRadius = 6371.0  // km
+const surfaceGravity = 9.81 // m/s²
+
+// spaceAltitude is where deep space starts, nothing pulls or slows from there
+func spaceAltitude() float64 {
+	return AtmosphereZones[len(AtmosphereZones)-1].Floor
+}
+
+// GravityAt returns the gravity at altitude in m/s². It follows the inverse
+// square law, tapered so it reaches exactly 0 at spaceAltitude.
+func GravityAt(altitude float64) float64 {
+	space := spaceAltitude()
+	if altitude <= 0 {
+		return surfaceGravity
+	} else if altitude >= space {
+		return 0
+	}
+
+	r := earthRadius / (earthRadius + altitude)
+	return surfaceGravity * r * r * (1 - smoothStep(altitude/space))
+}
+
+// AirDensityAt returns the air density at altitude relative to the ground,
+// from the barometric formula.
+func (t *Tuning) AirDensityAt(altitude float64) float64 {
+	if altitude <= 0 {
+		return 1
+	} else if altitude >= spaceAltitude() {
+		return 0
+	}
+
+	return math.Exp(-altitude / t.AirScaleHeight)
+}
+
+// Drag returns the share of velocity kept on every tick at altitude, the
+// atmosphere zones set it and the air thins it in the atmospheric mode.
+func (mode PhysicsMode) Drag(altitude float64, t *Tuning) float64 {
+	if mode == PhysicsAtmospheric {
+		return 1 - (1-DragAt(altitude))*t.AirDensityAt(altitude)
+	}
+
+	return DragAt(altitude)
+}
+
+// Gravity returns the velocity lost on every tick at altitude.
+func (mode PhysicsMode) Gravity(altitude float64, t *Tuning) float64 {
+	if mode == PhysicsAtmospheric {
+		return GravityAt(altitude) * t.GravityScale
+	}
+
+	return 0
+}
+
+func (mode PhysicsMode) String() string {
+	if mode == PhysicsAtmospheric {
+		return "Atmospheric"
+	}
+
+	return "Arcade"
+}
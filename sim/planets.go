@@ -0,0 +1,172 @@
+package sim
+
+import (
+	"github.com/ungerik/go3d/float64/vec2"
+	"math/rand"
+	"sort"
+)
+
+const PlanetScale = 4
+
+type Planet struct {
+	ID       uint
+	Position vec2.T
+	Velocity vec2.T
+	// Sprite is which of the planetVariants the planet looks like
+	Sprite          int
+	PlayerInfluence float64
+}
+
+// Center returns the middle of the planet, in world pixels.
+func (planet *Planet) Center() vec2.T {
+	center := copyVector(planet.Position)
+	center.Add(&vec2.T{PlanetSize / 2, PlanetSize / 2}).Scale(PlanetScale)
+	return center
+}
+
+func (planet *Planet) UpdatePosition(playerVelocity vec2.T) {
+	v := copyVector(planet.Velocity)
+	//v.Scale(2)
+	v.Add(&playerVelocity)
+	planet.Position.Add(&v)
+}
+
+const PlanetSize = 32
+const planetsUpdateInterval = (1 / 60.0) * 1000
+
+// planetVariants is how many planets there are to pick from
+const planetVariants = 10
+
+type PlanetsSpawner struct {
+	Active             map[uint]*Planet
+	Drawable           []*Planet
+	lastId             uint
+	timerAccumulator   float64
+	camera             *Camera
+	lastPlayerPosition vec2.T
+	// rng is the spawner's own so nothing else drawn changes its planets
+	rng    *rand.Rand
+	tuning *Tuning
+}
+
+func NewPlanetSpawner(camera *Camera) *PlanetsSpawner {
+	planets := new(PlanetsSpawner)
+	planets.camera = camera
+	planets.Active = make(map[uint]*Planet)
+	planets.SetSeed(0)
+	planets.tuning = DefaultTuning()
+
+	return planets
+}
+
+// SetTuning spawns the planets with t rather than the default tuning.
+func (spawner *PlanetsSpawner) SetTuning(t *Tuning) *PlanetsSpawner {
+	spawner.tuning = t
+	return spawner
+}
+
+// SetSeed makes the spawner draw its planets from seed.
+func (spawner *PlanetsSpawner) SetSeed(seed int64) *PlanetsSpawner {
+	spawner.rng = rand.New(rand.NewSource(seed))
+	return spawner
+}
+
+// Update runs the ticks delta ms hold.
+func (spawner *PlanetsSpawner) Update(delta int64) {
+	spawner.timerAccumulator += float64(delta)
+
+	for spawner.timerAccumulator >= planetsUpdateInterval {
+		spawner.timerAccumulator -= planetsUpdateInterval
+		spawner.tick()
+	}
+}
+
+// Step runs one tick of the spawner right away, for spawners simulated
+// outside of the game loop.
+func (spawner *PlanetsSpawner) Step() {
+	spawner.tick()
+}
+
+func (spawner *PlanetsSpawner) tick() {
+	newDrawables := []*Planet{}
+	for _, item := range spawner.Active {
+		v := copyVector(*spawner.camera.Velocity)
+		v.Scale(item.PlayerInfluence)
+		item.UpdatePosition(v)
+
+		if item.Position[1] > ScreenHeight {
+			PlanetsLog.WithField("planetId", item.ID).Trace("killing planet")
+			delete(spawner.Active, item.ID)
+		}
+
+		if item.Position[0] > -PlanetSize*PlanetScale &&
+			item.Position[1] > -PlanetSize*PlanetScale &&
+			item.Position[0] < ScreenWidth &&
+			item.Position[1] < ScreenHeight {
+			newDrawables = append(newDrawables, item)
+		}
+	}
+
+	sort.Slice(newDrawables, func(i, j int) bool {
+		return newDrawables[i].ID < newDrawables[j].ID
+	})
+	spawner.Drawable = newDrawables
+
+	// rolled on every tick of flight, so a seed spawns the same planets
+	// at the same time after launch
+	if spawner.camera.Flying && !spawner.camera.IsLifting {
+		roll := spawner.rng.Float64() < (planetsUpdateInterval/100)*spawner.tuning.PlanetSpawn
+		if roll && spawner.lastPlayerPosition != *spawner.camera.RelativePosition {
+			spawner.lastPlayerPosition = *spawner.camera.RelativePosition
+			spawner.Spawn()
+		}
+	}
+}
+
+// Spawn adds a planet around the edges of the screen, drifting towards the
+// players.
+func (spawner *PlanetsSpawner) Spawn() *Planet {
+	fx := (spawner.rng.Float64() * 2) - .5
+	px := fx * ((ScreenWidth - PlanetSize) / PlanetScale)
+	fy := spawner.rng.Float64()
+	if fx > 0 && fx < 1 {
+		fy *= .5
+	}
+	fy -= .5
+
+	py := fy * ((ScreenHeight - PlanetSize) / PlanetScale)
+
+	initPos := vec2.T{px, py}
+	initVel := copyVector(*spawner.camera.Position)
+	initVel.Sub(&initPos)
+	initVel.Normalize()
+	initVel.Scale(spawner.rng.Float64() * spawner.tuning.PlanetSpeed)
+
+	if initVel[1] < 1 && initVel[1] > 0 {
+		initVel[1] += 0.05
+	}
+
+	if initVel[0] > -1 && initVel[0] < 0 {
+		initVel[0] -= 0.05
+	} else if initVel[0] < 1 && initVel[0] > 0 {
+		initVel[0] += 0.05
+	}
+
+	p := Planet{
+		ID:              spawner.lastId + 1,
+		Sprite:          spawner.rng.Intn(planetVariants),
+		Position:        initPos,
+		Velocity:        initVel,
+		PlayerInfluence: (spawner.rng.Float64() * (spawner.tuning.PlanetInfluence / 2)) + (spawner.tuning.PlanetInfluence / 2),
+	}
+
+	PlanetsLog.WithFields(map[string]interface{}{
+		"position": initPos,
+		"velocity": initVel,
+	}).Trace("spawning new planet.")
+
+	spawner.Active[spawner.lastId+1] = &p
+	spawner.lastId++
+
+	return &p
+}
@@ -0,0 +1,208 @@
+package sim
+
+import (
+	"github.com/ungerik/go3d/float64/vec2"
+	"math/rand"
+	"sort"
+)
+
+const PowerupScale = 2
+
+type PowerupType string
+
+const FuelType PowerupType = "fuel"
+const O2Type PowerupType = "o2"
+
+type Powerup struct {
+	ID              uint
+	Position        vec2.T
+	Velocity        vec2.T
+	PlayerInfluence float64
+	Type            PowerupType
+	Box             vec2.Rect
+}
+
+func (powerup *Powerup) UpdatePosition(playerVelocity vec2.T) {
+	v := copyVector(powerup.Velocity)
+	//v.Scale(2)
+	v.Add(&playerVelocity)
+	powerup.Position.Add(&v)
+}
+
+// Center returns the middle of the powerup, in world pixels.
+func (powerup *Powerup) Center() vec2.T {
+	center := copyVector(powerup.Position)
+	center.Add(&vec2.T{PowerupSize / 2, PowerupSize / 2}).Scale(PowerupScale)
+	return center
+}
+
+const PowerupsUpdateInterval = (1 / 60.0) * 1000
+
+const PowerupSize = 32
+
+type PowerupsSpawner struct {
+	Active             map[uint]*Powerup
+	Drawable           []*Powerup
+	lastId             uint
+	timerAccumulator   float64
+	camera             *Camera
+	lastPlayerPosition vec2.T
+	sparkle            func(PowerupType, vec2.T)
+	// rng is the spawner's own so nothing else drawn changes its powerups
+	rng    *rand.Rand
+	tuning *Tuning
+}
+
+func NewPowerupSpawner(camera *Camera) *PowerupsSpawner {
+	Powerups := new(PowerupsSpawner)
+	Powerups.camera = camera
+	Powerups.Active = make(map[uint]*Powerup)
+	Powerups.SetSeed(0)
+	Powerups.tuning = DefaultTuning()
+
+	return Powerups
+}
+
+// SetTuning spawns the powerups with t rather than the default tuning.
+func (spawner *PowerupsSpawner) SetTuning(t *Tuning) *PowerupsSpawner {
+	spawner.tuning = t
+	return spawner
+}
+
+// SetSeed makes the spawner draw its powerups from seed, not the same way as
+// the planets of the seed.
+func (spawner *PowerupsSpawner) SetSeed(seed int64) *PowerupsSpawner {
+	spawner.rng = rand.New(rand.NewSource(seed ^ 0x9043))
+	return spawner
+}
+
+// SetSparkle calls sparkle with the type and the middle of every collected
+// powerup.
+func (spawner *PowerupsSpawner) SetSparkle(sparkle func(PowerupType, vec2.T)) *PowerupsSpawner {
+	spawner.sparkle = sparkle
+	return spawner
+}
+
+// Update runs the ticks delta ms hold.
+func (spawner *PowerupsSpawner) Update(delta int64) {
+	spawner.timerAccumulator += float64(delta)
+
+	for spawner.timerAccumulator >= PowerupsUpdateInterval {
+		spawner.timerAccumulator -= PowerupsUpdateInterval
+		spawner.tick()
+	}
+}
+
+// Step runs one tick of the spawner right away, for spawners simulated
+// outside of the game loop.
+func (spawner *PowerupsSpawner) Step() {
+	spawner.tick()
+}
+
+func (spawner *PowerupsSpawner) tick() {
+	newDrawables := []*Powerup{}
+	for _, item := range spawner.Active {
+		v := copyVector(*spawner.camera.Velocity)
+		v.Scale(item.PlayerInfluence)
+		item.UpdatePosition(v)
+
+		if item.Position[1] > ScreenHeight/PowerupScale || (item.Position[0] > ScreenWidth/PowerupScale || item.Position[0] < -ScreenWidth/PowerupScale) {
+			PowerupsLog.WithField("PowerupId", item.ID).Trace("killing Powerup")
+			delete(spawner.Active, item.ID)
+		}
+
+		if item.Position[0] > -PowerupSize*PowerupScale &&
+			item.Position[1] > -PowerupSize*PowerupScale &&
+			item.Position[0] < ScreenWidth &&
+			item.Position[1] < ScreenHeight {
+			newDrawables = append(newDrawables, item)
+		}
+
+		min := copyVector(item.Position)
+		min.Mul(&vec2.T{PowerupScale, PowerupScale})
+		max := copyVector(min)
+		max.Add(&vec2.T{PlanetSize * PowerupScale, PlanetSize * PowerupScale})
+
+		vPos := &vec2.Rect{min, max}
+		item.Box = *vPos
+		// the first player touching it gets it
+		for _, player := range spawner.camera.Players() {
+			if !player.Collition(vPos) {
+				continue
+			}
+
+			switch item.Type {
+			case FuelType:
+				player.AddFuel(100)
+			case O2Type:
+				player.AddO2(100)
+			}
+			center := copyVector(vPos.Min)
+			center.Add(&vPos.Max).Scale(.5)
+			if spawner.sparkle != nil {
+				spawner.sparkle(item.Type, center)
+			}
+			player.bus.Emit(Event{Kind: EventPickup, Player: player, Powerup: item.Type})
+			delete(spawner.Active, item.ID)
+			break
+		}
+	}
+
+	sort.Slice(newDrawables, func(i, j int) bool {
+		return newDrawables[i].ID < newDrawables[j].ID
+	})
+	spawner.Drawable = newDrawables
+
+	// rolled on every tick of flight, so a seed spawns the same powerups
+	// at the same time after launch
+	if spawner.camera.Flying && !spawner.camera.IsLifting {
+		roll := spawner.rng.Float64() < (PowerupsUpdateInterval/500)*spawner.tuning.PowerupSpawn
+		if roll && spawner.lastPlayerPosition != *spawner.camera.RelativePosition {
+			spawner.lastPlayerPosition = *spawner.camera.RelativePosition
+
+			puType := FuelType
+			if spawner.rng.Float64() < .5 {
+				puType = O2Type
+			}
+			spawner.Spawn(puType)
+		}
+	}
+}
+
+// Spawn adds a powerup of puType around the edges of the screen, drifting
+// towards the players.
+func (spawner *PowerupsSpawner) Spawn(puType PowerupType) *Powerup {
+	fx := (spawner.rng.Float64() * 2) - .5
+	px := fx * ((ScreenWidth - PowerupSize) / PowerupScale)
+	fy := spawner.rng.Float64()
+	if fx > 0 && fx < 1 {
+		fy *= .5
+	}
+	fy -= .5
+
+	py := fy * ((ScreenHeight - PowerupSize) / PowerupScale)
+
+	initPos := vec2.T{px, py}
+	initVel := copyVector(*spawner.camera.Position)
+	initVel.Sub(&initPos)
+	initVel.Normalize()
+	initVel.Scale(spawner.rng.Float64() * spawner.tuning.PowerupSpeed)
+
+	p := Powerup{
+		ID:              spawner.lastId + 1,
+		Position:        initPos,
+		Velocity:        initVel,
+		PlayerInfluence: (spawner.rng.Float64() * (spawner.tuning.PowerupInfluence / 2)) + (spawner.tuning.PowerupInfluence / 2),
+		Type:            puType,
+	}
+
+	PowerupsLog.WithFields(map[string]interface{}{
+		"position": initPos,
+		"velocity": initVel,
+	}).Trace("spawning new Powerup.")
+
+	spawner.Active[spawner.lastId+1] = &p
+	spawner.lastId++
+
+	return &p
+}
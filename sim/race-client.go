@@ -0,0 +1,325 @@
+package sim
+
+import (
+	"errors"
+	"github.com/ungerik/go3d/float64/vec2"
+	"math"
+	"net"
+	"time"
+)
+
+// netDialTimeout is how long joining a server may take
+const netDialTimeout = 5 * time.Second
+
+// raceSnapshots is how many snapshots a pilot keeps to move the others
+// between
+const raceSnapshots = 8
+
+// RaceClient flies a J0hn in the races of a RaceServer. The pilot's own
+// J0hn is predicted: every tick his input goes to the server and flies him
+// right away, and when a snapshot comes back he is put where the server had
+// him and the inputs it hadn't used yet are replayed. The other J0hns, the
+// camera, the planets and the powerups are moved between the snapshots,
+// netInterpTicks behind the server.
+type RaceClient struct {
+	conn     *netConn
+	incoming chan NetMessage
+	done     chan struct{}
+	race     *NetRace
+
+	players  []*J0hn
+	camera   vec2.T
+	planets  *PlanetsSpawner
+	powerups *PowerupsSpawner
+	// input is what the pilot holds, controls replay it on his J0hn. events
+	// gets what his J0hn does on the ticks he flies and the pickups the
+	// server tells of
+	input    Controls
+	controls Keys
+	events   *EventBus
+	seq      int64
+	unacked  []NetInput
+
+	snapshots  []*NetSnapshot
+	renderTick float64
+	clock      int64
+	over       bool
+}
+
+// DialRace joins the race server at addr as name, the game flies its next
+// race.
+func DialRace(addr, name string) (*RaceClient, error) {
+	conn, err := net.DialTimeout("tcp", addr, netDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &RaceClient{
+		conn:     newNetConn(conn),
+		incoming: make(chan NetMessage, 64),
+		done:     make(chan struct{}),
+	}
+	if err := c.conn.Send(NetMessage{Hello: &NetHello{Version: netVersion, Name: name}}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	go c.read()
+
+	return c, nil
+}
+
+// SetInput flies the pilot's J0hn with in.
+func (c *RaceClient) SetInput(in Controls) *RaceClient {
+	c.input = in
+	return c
+}
+
+// SetEvents tells bus what the pilot's J0hn does and of the powerups he
+// collects.
+func (c *RaceClient) SetEvents(bus *EventBus) *RaceClient {
+	c.events = bus
+	return c
+}
+
+func (c *RaceClient) read() {
+	for {
+		m, err := c.conn.Receive()
+		if err != nil {
+			m = NetMessage{Error: err.Error()}
+		}
+
+		select {
+		case c.incoming <- m:
+		case <-c.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Close leaves the server, once.
+func (c *RaceClient) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+
+	close(c.done)
+	return c.conn.Close()
+}
+
+// Race is the race flown, nil before the first one or offline.
+func (c *RaceClient) Race() *NetRace {
+	if c == nil {
+		return nil
+	}
+	return c.race
+}
+
+// Poll handles what the server sent since the last frame. It returns a race
+// the server started for the game to build, or why the server is gone.
+func (c *RaceClient) Poll() (*NetRace, error) {
+	for {
+		select {
+		case m := <-c.incoming:
+			switch {
+			case m.Error != "":
+				return nil, errors.New(m.Error)
+			case m.Race != nil:
+				// the snapshots after it are for the run of the new race
+				c.race = m.Race
+				c.players = nil
+				return m.Race, nil
+			case m.Snapshot != nil:
+				c.receive(m.Snapshot)
+			}
+		default:
+			return nil, nil
+		}
+	}
+}
+
+// Watch flies the J0hns of a run built for the race. The snapshots move the
+// others, the camera, the planets and the powerups, their own Update must not
+// run.
+func (c *RaceClient) Watch(players []*J0hn, camera *Camera, planets *PlanetsSpawner, powerups *PowerupsSpawner) {
+	c.players = players
+	c.planets = planets
+	c.powerups = powerups
+	c.unacked = nil
+	c.snapshots = nil
+	c.clock = 0
+	c.over = false
+
+	c.camera = *camera.RelativePosition
+	camera.Track(&c.camera)
+	// the others only go where the snapshots put them, they do nothing to
+	// tell of
+	for _, p := range players {
+		p.SetEvents(nil)
+	}
+	c.you().SetControls(&c.controls).SetEvents(c.events)
+}
+
+func (c *RaceClient) you() *J0hn {
+	return c.players[c.race.You]
+}
+
+// Players are the J0hns of the race, nil until its run is watched.
+func (c *RaceClient) Players() []*J0hn {
+	return c.players
+}
+
+// Over is whether the race is over, the next one starts soon.
+func (c *RaceClient) Over() bool {
+	return c.over
+}
+
+// Update flies the pilot's J0hn for the ticks delta ms hold and moves the
+// rest to where the server had them.
+func (c *RaceClient) Update(delta int64) {
+	if c.players == nil {
+		return
+	}
+
+	// after a hitch the pilot doesn't get to fly a burst of ticks
+	c.clock = int64(math.Min(float64(c.clock+delta), netInputBacklog*netTick))
+	for c.clock >= netTick {
+		c.clock -= netTick
+		c.tick()
+	}
+
+	c.renderTick += float64(delta) / netTick
+	c.interpolate()
+}
+
+// tick sends what the pilot holds and flies his J0hn with it right away.
+func (c *RaceClient) tick() {
+	var held Keys
+	if c.input != nil {
+		held = c.input.Held()
+	}
+
+	c.seq++
+	in := NetInput{
+		Seq:    c.seq,
+		Thrust: held.Thrust,
+		Left:   held.Left,
+		Right:  held.Right,
+	}
+	if err := c.conn.Send(NetMessage{Input: &in}); err != nil {
+		// the reader hears about it too, Poll leaves the race
+		NetLog.Debugln("can't send input:", err)
+	}
+
+	c.unacked = append(c.unacked, in)
+	c.controls = in.keys()
+	c.you().Step()
+}
+
+func (c *RaceClient) receive(s *NetSnapshot) {
+	if c.players == nil || len(s.Pilots) != len(c.players) {
+		return
+	}
+
+	c.snapshots = append(c.snapshots, s)
+	if len(c.snapshots) > raceSnapshots {
+		c.snapshots = c.snapshots[1:]
+	}
+	c.over = s.Over
+
+	// the others are shown a bit behind the server, the clock is set back
+	// there when it drifted off
+	target := float64(s.Tick - netInterpTicks)
+	if math.Abs(c.renderTick-target) > netInterpTicks {
+		c.renderTick = target
+	}
+
+	c.reconcile(s)
+	for _, pickup := range s.Pickups {
+		if pickup.Pilot != c.race.You {
+			continue
+		}
+		c.events.Emit(Event{Kind: EventPickup, Player: c.you(), Powerup: pickup.Type})
+	}
+}
+
+// reconcile puts the pilot's J0hn where the server had him and replays the
+// inputs it hadn't used yet.
+func (c *RaceClient) reconcile(s *NetSnapshot) {
+	for len(c.unacked) > 0 && c.unacked[0].Seq <= s.Ack {
+		c.unacked = c.unacked[1:]
+	}
+
+	// the replayed ticks were told of when they were flown
+	j0hn := c.you()
+	s.Pilots[c.race.You].apply(j0hn)
+	j0hn.SetEvents(nil)
+	for _, in := range c.unacked {
+		c.controls = in.keys()
+		j0hn.Step()
+	}
+	j0hn.SetEvents(c.events)
+}
+
+// interpolate moves the other J0hns, the camera, the planets and the
+// powerups to where they were at renderTick.
+func (c *RaceClient) interpolate() {
+	if len(c.snapshots) == 0 {
+		return
+	}
+
+	last := c.snapshots[len(c.snapshots)-1]
+	a, b := last, last
+	for i, s := range c.snapshots {
+		if float64(s.Tick) >= c.renderTick {
+			a, b = s, s
+			if i > 0 {
+				a = c.snapshots[i-1]
+			}
+			break
+		}
+	}
+	f := 0.0
+	if b.Tick > a.Tick {
+		f = clamp01((c.renderTick - float64(a.Tick)) / float64(b.Tick-a.Tick))
+	}
+
+	c.camera = lerpVector(a.Camera, b.Camera, f)
+	for i, p := range c.players {
+		if i != c.race.You {
+			lerpPilot(a.Pilots[i], b.Pilots[i], f).apply(p)
+		}
+	}
+
+	planets := make(map[uint]*Planet)
+	var drawablePlanets []*Planet
+	for _, body := range b.Planets {
+		planet, ok := c.planets.Active[body.ID]
+		if !ok {
+			planet = &Planet{ID: body.ID, Sprite: body.Sprite}
+		}
+		planet.Position = bodyAt(a.Planets, body, f)
+		planets[body.ID] = planet
+		drawablePlanets = append(drawablePlanets, planet)
+	}
+	c.planets.Active = planets
+	c.planets.Drawable = drawablePlanets
+
+	powerups := make(map[uint]*Powerup)
+	var drawablePowerups []*Powerup
+	for _, body := range b.Powerups {
+		powerup, ok := c.powerups.Active[body.ID]
+		if !ok {
+			powerup = &Powerup{ID: body.ID, Type: body.Type}
+		}
+		powerup.Position = bodyAt(a.Powerups, body, f)
+		powerups[body.ID] = powerup
+		drawablePowerups = append(drawablePowerups, powerup)
+	}
+	c.powerups.Active = powerups
+	c.powerups.Drawable = drawablePowerups
+}
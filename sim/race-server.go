@@ -0,0 +1,435 @@
+package sim
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// raceRestartTime is how long, in ms, a race goes on once it is over before
+// the next one starts
+const raceRestartTime = 5000
+
+// raceMaxTime is how long, in ms, a race goes on after the first launch
+// before it is over anyway, so the pilots waiting for the next one don't wait
+// forever on a pilot who keeps finding o2
+const raceMaxTime = 5 * 60 * 1000
+
+// A pilot whose next input is late keeps the last one for netInputHold
+// ticks, then lets go of every key. Inputs more than netInputBacklog ahead
+// are dropped so a pilot catches up rather than lagging behind for good.
+const netInputHold = 5
+const netInputBacklog = 8
+
+// RaceServer is the authority of network races. It runs the co-op run of
+// the pilots connected to it without drawing it: their J0hns, the camera
+// framing them, the planets and the powerups, and streams snapshots of it.
+// Pilots joining while everybody still stands on the platform join the
+// race right away, later ones the next race: it starts raceRestartTime after
+// every pilot who launched ran out of o2, or after raceMaxTime of racing.
+type RaceServer struct {
+	listener net.Listener
+	physics  PhysicsMode
+	// tuning is the server's own, the console of a hosting game changes the
+	// game's while the races run on another goroutine
+	tuning *Tuning
+	// bus gets the events of the J0hns of the server
+	bus *EventBus
+
+	mu     sync.Mutex
+	pilots []*racePilot
+	race   *serverRace
+	closed chan struct{}
+}
+
+type racePilot struct {
+	name string
+	conn *netConn
+	out  chan NetMessage
+	// keys fly the J0hn of the pilot with inputs, the ones not used yet.
+	// ack is the last input used, held how many ticks last was used for
+	keys   Keys
+	inputs []NetInput
+	last   NetInput
+	held   int
+	ack    int64
+	gone   bool
+}
+
+type serverRace struct {
+	seed     int64
+	pilots   []*racePilot
+	players  []*J0hn
+	camera   *Camera
+	planets  *PlanetsSpawner
+	powerups *PowerupsSpawner
+	tick     int64
+	// flew is whether each pilot left the platform, launch the tick the
+	// first one did at and over the tick the race ended at, 0 until then
+	flew    []bool
+	launch  int64
+	over    int64
+	pickups []NetPickup
+}
+
+// NewRaceServer listens for pilots on addr, its races are flown with
+// physics and a copy of tuning.
+func NewRaceServer(addr string, physics PhysicsMode, tuning *Tuning) (*RaceServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	own := *tuning
+	s := &RaceServer{
+		listener: listener,
+		physics:  physics,
+		tuning:   &own,
+		bus:      &EventBus{},
+		closed:   make(chan struct{}),
+	}
+	s.bus.Subscribe(s.handle)
+	return s, nil
+}
+
+// Addr is where pilots join the server.
+func (s *RaceServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Serve runs the races until Close.
+func (s *RaceServer) Serve() error {
+	go s.run()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.closed:
+				return nil
+			default:
+				return err
+			}
+		}
+		go s.serve(conn)
+	}
+}
+
+// Close stops the server and drops every pilot.
+func (s *RaceServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.closed:
+		return nil
+	default:
+	}
+
+	close(s.closed)
+	for _, p := range s.pilots {
+		_ = p.conn.Close()
+	}
+	return s.listener.Close()
+}
+
+func (s *RaceServer) serve(conn net.Conn) {
+	c := newNetConn(conn)
+	defer c.Close()
+
+	m, err := c.Receive()
+	if err != nil {
+		NetLog.WithField("addr", conn.RemoteAddr()).Warnln("pilot left before saying hello:", err)
+		return
+	}
+	if m.Hello == nil || m.Hello.Version != netVersion {
+		_ = c.Send(NetMessage{Error: fmt.Sprintf("expected race protocol %d", netVersion)})
+		return
+	}
+
+	pilot, err := s.join(m.Hello.Name, c)
+	if err != nil {
+		_ = c.Send(NetMessage{Error: err.Error()})
+		return
+	}
+	go pilot.write()
+
+	for {
+		m, err := c.Receive()
+		if err != nil {
+			break
+		}
+		if m.Input != nil {
+			s.mu.Lock()
+			pilot.queue(*m.Input)
+			s.mu.Unlock()
+		}
+	}
+	s.leave(pilot)
+}
+
+func (s *RaceServer) join(name string, conn *netConn) (*racePilot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pilots) >= MaxPlayers {
+		return nil, fmt.Errorf("the server is full, %d pilots at most", MaxPlayers)
+	}
+
+	p := &racePilot{
+		name: name,
+		conn: conn,
+		out:  make(chan NetMessage, 64),
+	}
+	s.pilots = append(s.pilots, p)
+	NetLog.WithField("pilot", name).Infoln("pilot joined")
+
+	if s.race == nil {
+		s.start(newRaceSeed())
+	} else if !s.race.launched() {
+		s.start(s.race.seed)
+	}
+	return p, nil
+}
+
+func (s *RaceServer) leave(p *racePilot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.gone = true
+	close(p.out)
+	p.keys = Keys{}
+	for i, other := range s.pilots {
+		if other == p {
+			s.pilots = append(s.pilots[:i], s.pilots[i+1:]...)
+			break
+		}
+	}
+	NetLog.WithField("pilot", p.name).Infoln("pilot left")
+
+	if len(s.pilots) == 0 {
+		s.race = nil
+	} else if !s.race.launched() {
+		s.start(s.race.seed)
+	}
+}
+
+// start puts every pilot on the platform for a new race from seed.
+func (s *RaceServer) start(seed int64) {
+	n := len(s.pilots)
+	race := &serverRace{seed: seed, pilots: append([]*racePilot(nil), s.pilots...), flew: make([]bool, n)}
+
+	var names []string
+	for i, p := range s.pilots {
+		p.inputs, p.last, p.held = nil, NetInput{Seq: p.ack}, 0
+		j0hn := NewJ0hn().SetPlayer(i).SetPosition(StandingPosition(i, n)).SetPhysicsMode(s.physics).
+			SetControls(&p.keys).SetEvents(s.bus).SetTuning(s.tuning)
+		race.players = append(race.players, j0hn)
+		names = append(names, p.name)
+	}
+	race.camera = NewCamera(race.players...)
+	race.planets = NewPlanetSpawner(race.camera).SetSeed(seed).SetTuning(s.tuning)
+	race.powerups = NewPowerupSpawner(race.camera).SetSeed(seed).SetTuning(s.tuning)
+	s.race = race
+
+	for i, p := range s.pilots {
+		p.send(NetMessage{Race: &NetRace{Seed: seed, Physics: s.physics, Pilots: names, You: i}})
+	}
+	NetLog.WithFields(log.Fields{"seed": seed, "pilots": n}).Infoln("race started")
+}
+
+func newRaceSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+func (s *RaceServer) handle(e Event) {
+	if e.Kind == EventPickup && s.race != nil {
+		s.race.pickups = append(s.race.pickups, NetPickup{Pilot: e.Player.Index, Type: e.Powerup})
+	}
+}
+
+func (s *RaceServer) run() {
+	ticker := time.NewTicker(netTick * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.step()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// step runs a tick of the race, the same way the game updates a run, and
+// sends the pilots a snapshot every snapshotEvery ticks.
+func (s *RaceServer) step() {
+	race := s.race
+	if race == nil {
+		return
+	}
+	if race.over > 0 && (race.tick-race.over)*netTick >= raceRestartTime {
+		s.start(newRaceSeed())
+		return
+	}
+
+	for _, p := range race.pilots {
+		if !p.gone {
+			p.next()
+		}
+	}
+	// a step is one physics tick of everything, as on the pilots
+	race.planets.Step()
+	race.powerups.Step()
+	for _, j0hn := range race.players {
+		j0hn.Step()
+	}
+	race.camera.Step()
+	race.tick++
+
+	for i, j0hn := range race.players {
+		if j0hn.Flying || j0hn.IsLifting {
+			race.flew[i] = true
+		}
+	}
+	if race.launch == 0 && race.launched() {
+		race.launch = race.tick
+	}
+	if race.over == 0 && race.finished() {
+		race.over = race.tick
+		NetLog.WithField("seed", race.seed).Infoln("race over")
+	}
+	if race.tick%snapshotEvery == 0 {
+		s.broadcast()
+	}
+}
+
+func (s *RaceServer) broadcast() {
+	race := s.race
+	snapshot := NetSnapshot{
+		Tick:    race.tick,
+		Camera:  *race.camera.RelativePosition,
+		Pickups: race.pickups,
+		Over:    race.over > 0,
+	}
+	race.pickups = nil
+
+	for i, j0hn := range race.players {
+		state := pilotState(j0hn)
+		state.Gone = race.pilots[i].gone
+		snapshot.Pilots = append(snapshot.Pilots, state)
+	}
+	for _, planet := range race.planets.Active {
+		snapshot.Planets = append(snapshot.Planets, NetBody{
+			ID:       planet.ID,
+			Position: planet.Position,
+			Sprite:   planet.Sprite,
+		})
+	}
+	for _, powerup := range race.powerups.Active {
+		snapshot.Powerups = append(snapshot.Powerups, NetBody{
+			ID:       powerup.ID,
+			Position: powerup.Position,
+			Type:     powerup.Type,
+		})
+	}
+	sort.Slice(snapshot.Planets, func(i, j int) bool { return snapshot.Planets[i].ID < snapshot.Planets[j].ID })
+	sort.Slice(snapshot.Powerups, func(i, j int) bool { return snapshot.Powerups[i].ID < snapshot.Powerups[j].ID })
+
+	for _, p := range race.pilots {
+		if p.gone {
+			continue
+		}
+		own := snapshot
+		own.Ack = p.ack
+		p.send(NetMessage{Snapshot: &own})
+	}
+}
+
+// launched is whether a pilot still racing left the platform yet.
+func (r *serverRace) launched() bool {
+	for i, flew := range r.flew {
+		if flew && !r.pilots[i].gone {
+			return true
+		}
+	}
+	return false
+}
+
+// finished is whether every pilot still racing who launched ran out of o2,
+// or the race went on for raceMaxTime. The pilots left on the platform don't
+// hold it up.
+func (r *serverRace) finished() bool {
+	if r.launch > 0 && (r.tick-r.launch)*netTick >= raceMaxTime {
+		return true
+	}
+	if !r.launched() {
+		return false
+	}
+
+	for i, j0hn := range r.players {
+		if r.flew[i] && !r.pilots[i].gone && j0hn.O2 > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// queue keeps an input of the pilot until the tick it's for.
+func (p *racePilot) queue(in NetInput) {
+	if in.Seq <= p.ack {
+		return
+	}
+
+	p.inputs = append(p.inputs, in)
+	if len(p.inputs) > netInputBacklog {
+		p.inputs = p.inputs[len(p.inputs)-netInputBacklog:]
+	}
+}
+
+// next presses the input of the pilot for this tick.
+func (p *racePilot) next() {
+	if len(p.inputs) > 0 {
+		p.last, p.inputs = p.inputs[0], p.inputs[1:]
+		p.ack = p.last.Seq
+		p.held = 0
+	} else {
+		p.held++
+		if p.held > netInputHold {
+			p.last = NetInput{Seq: p.last.Seq}
+		}
+	}
+	p.keys = p.last.keys()
+}
+
+// send queues m for the pilot. When it can't keep up a snapshot is dropped,
+// the next one tells the same, but the pilot is disconnected for anything
+// else so it never flies a race it didn't hear of.
+func (p *racePilot) send(m NetMessage) {
+	select {
+	case p.out <- m:
+	default:
+		if m.Snapshot != nil {
+			NetLog.WithField("pilot", p.name).Debugln("pilot lagging, snapshot dropped")
+			return
+		}
+		// the reader notices and the pilot leaves
+		NetLog.WithField("pilot", p.name).Warnln("pilot lagging too far behind, disconnected")
+		_ = p.conn.Close()
+	}
+}
+
+func (p *racePilot) write() {
+	for m := range p.out {
+		if err := p.conn.Send(m); err != nil {
+			// the reader notices and the pilot leaves
+			_ = p.conn.Close()
+		}
+	}
+}
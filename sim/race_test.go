@@ -0,0 +1,251 @@
+package sim
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// raceTestTimeout is how long the loopback tests wait for the server
+const raceTestTimeout = 5 * time.Second
+
+// startRace runs a race server on a loopback port for a test.
+func startRace(t *testing.T) *RaceServer {
+	s, err := NewRaceServer("127.0.0.1:0", PhysicsArcade, DefaultTuning())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if err := s.Serve(); err != nil {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// dialRace joins s as name, flown with keys.
+func dialRace(t *testing.T, s *RaceServer, name string, keys *Keys) *RaceClient {
+	c, err := DialRace(s.Addr(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetInput(keys)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+// watchRace builds the run of race for c the way the game does.
+func watchRace(c *RaceClient, race *NetRace) {
+	var players []*J0hn
+	for i := range race.Pilots {
+		players = append(players, NewJ0hn().SetPlayer(i).SetPosition(StandingPosition(i, len(race.Pilots))).
+			SetPhysicsMode(race.Physics))
+	}
+	camera := NewCamera(players...)
+	c.Watch(players, camera, NewPlanetSpawner(camera).SetSeed(race.Seed), NewPowerupSpawner(camera).SetSeed(race.Seed))
+}
+
+// await polls the clients until done, flying them for a tick every round
+// when fly is set.
+func await(t *testing.T, what string, fly bool, done func() bool, clients ...*RaceClient) {
+	t.Helper()
+
+	deadline := time.Now().Add(raceTestTimeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for", what)
+		}
+
+		for _, c := range clients {
+			race, err := c.Poll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if race != nil {
+				watchRace(c, race)
+			}
+			if fly {
+				c.Update(netTick)
+			}
+		}
+		time.Sleep(time.Millisecond)
+		if fly {
+			time.Sleep(netTick * time.Millisecond)
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+func lastSnapshot(c *RaceClient) *NetSnapshot {
+	if len(c.snapshots) == 0 {
+		return nil
+	}
+	return c.snapshots[len(c.snapshots)-1]
+}
+
+func TestRaceLoopback(t *testing.T) {
+	s := startRace(t)
+	var keysA, keysB Keys
+	a := dialRace(t, s, "a", &keysA)
+	launches := 0
+	bus := &EventBus{}
+	bus.Subscribe(func(e Event) {
+		if e.Kind == EventLaunch {
+			launches++
+		}
+	})
+	a.SetEvents(bus)
+	await(t, "the race of a", false, func() bool { return a.Race() != nil }, a)
+
+	// nobody launched yet, so b joins the race of a
+	b := dialRace(t, s, "b", &keysB)
+	both := func() bool {
+		return a.Race() != nil && len(a.Race().Pilots) == 2 && a.Players() != nil &&
+			b.Race() != nil && len(b.Race().Pilots) == 2 && b.Players() != nil
+	}
+	await(t, "the race of a and b", false, both, a, b)
+	if a.Race().Seed != b.Race().Seed || a.Race().You != 0 || b.Race().You != 1 {
+		t.Fatalf("expected a and b in the same race as pilots 0 and 1, got %+v and %+v", a.Race(), b.Race())
+	}
+	if a.Race().Pilots[0] != "a" || a.Race().Pilots[1] != "b" {
+		t.Errorf("expected pilots a and b, got %v", a.Race().Pilots)
+	}
+
+	// a thrusts off the platform, the server acks his inputs
+	keysA.Thrust = true
+	await(t, "a launching", true, func() bool {
+		last := lastSnapshot(a)
+		return last != nil && last.Ack > 0 && last.Pilots[0].Flying
+	}, a, b)
+	keysA.Thrust = false
+
+	// once every input of a is acked, his J0hn is where the server has him
+	await(t, "every input of a acked", false, func() bool {
+		last := lastSnapshot(a)
+		return last != nil && last.Ack == a.seq
+	}, a, b)
+	if len(a.unacked) != 0 {
+		t.Errorf("expected no unacked inputs, got %d", len(a.unacked))
+	}
+	server := lastSnapshot(a).Pilots[0]
+	j0hn := a.Players()[0]
+	if *j0hn.RelativePosition != server.Position || *j0hn.Velocity != server.Velocity || j0hn.Flying != server.Flying {
+		t.Errorf("expected a at %v going %v, got %v going %v",
+			server.Position, server.Velocity, *j0hn.RelativePosition, *j0hn.Velocity)
+	}
+	if j0hn.RelativePosition[1] <= 0 {
+		t.Errorf("expected a above the ground, got %v", *j0hn.RelativePosition)
+	}
+	if launches != 1 {
+		t.Errorf("expected the launch of a told once, got %d", launches)
+	}
+
+	// b sees a fly
+	await(t, "b seeing a fly", false, func() bool {
+		last := lastSnapshot(b)
+		return last != nil && last.Pilots[0].Flying
+	}, a, b)
+
+	// b leaves a launched race, a keeps racing with b gone
+	_ = b.Close()
+	await(t, "b gone", false, func() bool {
+		last := lastSnapshot(a)
+		return last != nil && last.Pilots[1].Gone
+	}, a)
+	if len(a.Race().Pilots) != 2 {
+		t.Errorf("expected a to keep racing the race of two, got %v", a.Race().Pilots)
+	}
+	s.mu.Lock()
+	pilots := len(s.pilots)
+	s.mu.Unlock()
+	if pilots != 1 {
+		t.Errorf("expected 1 pilot on the server, got %d", pilots)
+	}
+}
+
+func TestRaceRestartsWhenPilotLeavesBeforeLaunch(t *testing.T) {
+	s := startRace(t)
+	var keysA, keysB Keys
+	a := dialRace(t, s, "a", &keysA)
+	b := dialRace(t, s, "b", &keysB)
+	await(t, "the race of a and b", false, func() bool {
+		return a.Race() != nil && len(a.Race().Pilots) == 2
+	}, a, b)
+
+	_ = b.Close()
+	await(t, "a racing alone", false, func() bool {
+		return len(a.Race().Pilots) == 1
+	}, a)
+	if a.Race().You != 0 {
+		t.Errorf("expected a to be pilot 0, got %d", a.Race().You)
+	}
+}
+
+func TestRaceFinished(t *testing.T) {
+	race := func(flew []bool, gone []bool, o2 []float64) *serverRace {
+		r := &serverRace{flew: flew, tick: 1}
+		for i := range flew {
+			r.pilots = append(r.pilots, &racePilot{gone: gone[i]})
+			r.players = append(r.players, &J0hn{O2: o2[i]})
+		}
+		return r
+	}
+
+	cases := []struct {
+		name     string
+		flew     []bool
+		gone     []bool
+		o2       []float64
+		finished bool
+	}{
+		{"nobody launched", []bool{false, false}, []bool{false, false}, []float64{100, 100}, false},
+		{"flying", []bool{true, false}, []bool{false, false}, []float64{50, 100}, false},
+		{"launched pilots out", []bool{true, false}, []bool{false, false}, []float64{0, 100}, true},
+		{"one still flying", []bool{true, true}, []bool{false, false}, []float64{0, 20}, false},
+		{"flying pilot gone", []bool{true, true}, []bool{false, true}, []float64{0, 20}, true},
+		{"only flier gone", []bool{true, false}, []bool{true, false}, []float64{50, 100}, false},
+	}
+	for _, c := range cases {
+		if got := race(c.flew, c.gone, c.o2).finished(); got != c.finished {
+			t.Errorf("%s: expected finished %v, got %v", c.name, c.finished, got)
+		}
+	}
+
+	long := race([]bool{true}, []bool{false}, []float64{100})
+	long.launch = 1
+	long.tick = long.launch + raceMaxTime/netTick + 1
+	if !long.finished() {
+		t.Error("expected a race over after raceMaxTime")
+	}
+}
+
+func TestRacePilotLagging(t *testing.T) {
+	conn, other := net.Pipe()
+	defer other.Close()
+	p := &racePilot{name: "slow", conn: newNetConn(conn), out: make(chan NetMessage, 1)}
+	p.send(NetMessage{Snapshot: &NetSnapshot{Tick: 1}})
+
+	// a snapshot too many is dropped, the pilot stays
+	p.send(NetMessage{Snapshot: &NetSnapshot{Tick: 2}})
+	if len(p.out) != 1 || (<-p.out).Snapshot.Tick != 1 {
+		t.Fatal("expected only the first snapshot queued")
+	}
+	_ = other.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := other.Read(make([]byte, 1)); !isTimeout(err) {
+		t.Fatalf("expected the pilot connected, got %v", err)
+	}
+
+	// a race too many disconnects the pilot
+	p.send(NetMessage{Snapshot: &NetSnapshot{Tick: 3}})
+	p.send(NetMessage{Race: &NetRace{Seed: 1}})
+	_ = other.SetReadDeadline(time.Now().Add(raceTestTimeout))
+	if _, err := other.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected the pilot disconnected, got %v", err)
+	}
+}
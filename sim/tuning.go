@@ -0,0 +1,35 @@
+package sim
+
+// Tuning is the tuning of the simulation, the developer console changes the
+// game's. J0hn and the spawners read the tuning they were given, the race
+// server flies its races with a copy of its own.
+type Tuning struct {
+	// AirScaleHeight is in km, stretched from the real 8.5 so it lasts past
+	// lift-off
+	AirScaleHeight float64
+	// GravityScale turns m/s² into velocity units lost per tick
+	GravityScale float64
+
+	// PlanetSpawn is the chance of a new planet every 100ms, PlanetSpeed the
+	// top speed of new ones and PlanetInfluence how much J0hn's velocity
+	// moves them. The powerups roll every 500ms.
+	PlanetSpawn      float64
+	PlanetSpeed      float64
+	PlanetInfluence  float64
+	PowerupSpawn     float64
+	PowerupSpeed     float64
+	PowerupInfluence float64
+}
+
+func DefaultTuning() *Tuning {
+	return &Tuning{
+		AirScaleHeight:   150,
+		GravityScale:     .08 / surfaceGravity,
+		PlanetSpawn:      .01,
+		PlanetSpeed:      .1,
+		PlanetInfluence:  .025,
+		PowerupSpawn:     .1,
+		PowerupSpeed:     .5,
+		PowerupInfluence: .05,
+	}
+}
@@ -0,0 +1,45 @@
+// Package sim is the simulation of a run without anything drawn or played:
+// J0hn, the camera, the planets, the powerups and the network races. The
+// race server runs it headless.
+package sim
+
+import "github.com/ungerik/go3d/float64/vec2"
+
+const (
+	// ScreenWidth and ScreenHeight are the screen the run is framed on, in
+	// world pixels
+	ScreenWidth  = 800
+	ScreenHeight = 600
+
+	// PlayerSize is the side of a J0hn sprite frame, drawn J0hnScale times
+	// larger
+	PlayerSize = 64
+	J0hnScale  = 3.0
+
+	// PixelsPerKm is how far the background scrolls for each km J0hn climbs,
+	// both come from his velocity: scaled by Tick/300 for the background and
+	// by Tick/1000 for RelativePosition.
+	PixelsPerKm = 1000.0 / 300
+
+	// LiftOffRows are the screens of sky above the platform J0hn lifts off
+	// through, LiftOffAltitude is where they have all gone below the top of
+	// the screen and he stops lifting off, in km
+	LiftOffRows     = 2
+	LiftOffAltitude = ScreenHeight * LiftOffRows / PixelsPerKm
+
+	// MaxPlayers is how many J0hns can fly together on one screen
+	MaxPlayers = 4
+)
+
+// coopSpacing is how far apart, in world pixels, the players stand on the
+// platform
+const coopSpacing = 40
+
+// StandingPosition is where the index-th of n players stands on the
+// platform, in world pixels.
+func StandingPosition(index, n int) vec2.T {
+	return vec2.T{
+		(ScreenWidth-(PlayerSize*J0hnScale))/2 + (float64(index)-float64(n-1)/2)*coopSpacing,
+		(ScreenHeight - (PlayerSize * J0hnScale)) - 77,
+	}
+}
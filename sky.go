@@ -0,0 +1,44 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/ungerik/go3d/float64/vec3"
+	"math"
+	"strings"
+)
+
+// zoneGradients are the parsed Sky gradients of the atmosphere zones
+var zoneGradients = make(map[*sim.AtmosphereZone]*Gradient)
+
+func init() {
+	for _, zone := range sim.AtmosphereZones {
+		grad, err := ParseCSSGradient(zone.Sky)
+		if err != nil {
+			Panic("atmosphere", map[string]interface{}{"zone": zone.Name}, err)
+		}
+
+		// prepared here, tile workers read the gradients concurrently
+		grad.prepare()
+		zoneGradients[zone] = grad
+	}
+}
+
+// zoneMessageKey is the message key of the name of a zone.
+func zoneMessageKey(name string) string {
+	return "zone." + strings.ReplaceAll(strings.ToLower(name), " ", "_")
+}
+
+// zoneProgress is how far through its zone altitude is, from 0 to 1.
+func zoneProgress(zone, next *sim.AtmosphereZone, altitude float64) float64 {
+	if next == nil {
+		return 0
+	}
+
+	return clampUnit((altitude - zone.Floor) / (next.Floor - zone.Floor))
+}
+
+// SkyColorAt returns the sky colour at altitude as sRGB in the 0..1 range.
+func SkyColorAt(altitude float64) vec3.T {
+	zone, next, _ := sim.AtmosphereAt(math.Max(altitude, 0))
+	return zoneGradients[zone].ExactColor(zoneProgress(zone, next, altitude))
+}
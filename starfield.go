@@ -0,0 +1,190 @@
+package main
+
+import (
+	"0ms2/sim"
+	"github.com/ungerik/go3d/float64/vec3"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// Star tiles are generated from a hash of their grid coordinates and the run
+// seed, so flying back over an area shows exactly the same sky. The sky under
+// the stars comes from the atmosphere zone at each row's altitude.
+
+const starRegionSpan = 1400.0
+const starDensityMin = .25
+const starDensityMax = 2.5
+
+type starClass struct {
+	tint                 color.RGBA
+	weight               float64
+	minBright, maxBright float64
+	sizeOdds             [3]float64
+}
+
+// Tints loosely follow the black body colour of each spectral class, from hot
+// blue O stars to cool red M dwarfs. Dim reddish stars are the most common.
+var starClasses = []starClass{
+	{tint: color.RGBA{155, 176, 255, 255}, weight: .03, minBright: .8, maxBright: 1, sizeOdds: [3]float64{.4, .4, .2}},
+	{tint: color.RGBA{170, 191, 255, 255}, weight: .07, minBright: .7, maxBright: 1, sizeOdds: [3]float64{.6, .3, .1}},
+	{tint: color.RGBA{202, 215, 255, 255}, weight: .12, minBright: .6, maxBright: 1, sizeOdds: [3]float64{.75, .2, .05}},
+	{tint: color.RGBA{248, 247, 255, 255}, weight: .18, minBright: .5, maxBright: .9, sizeOdds: [3]float64{.85, .15, 0}},
+	{tint: color.RGBA{255, 244, 234, 255}, weight: .2, minBright: .4, maxBright: .9, sizeOdds: [3]float64{.9, .1, 0}},
+	{tint: color.RGBA{255, 210, 161, 255}, weight: .2, minBright: .3, maxBright: .7, sizeOdds: [3]float64{.95, .05, 0}},
+	{tint: color.RGBA{255, 204, 111, 255}, weight: .2, minBright: .2, maxBright: .5, sizeOdds: [3]float64{1, 0, 0}},
+}
+
+func splitMix(h uint64) uint64 {
+	h += 0x9E3779B97F4A7C15
+	h = (h ^ (h >> 30)) * 0xBF58476D1CE4E5B9
+	h = (h ^ (h >> 27)) * 0x94D049BB133111EB
+	return h ^ (h >> 31)
+}
+
+// cellHash mixes the run seed with a pair of grid coordinates.
+func cellHash(seed int64, x, y int) uint64 {
+	h := splitMix(uint64(seed))
+	h = splitMix(h ^ uint64(int64(x)))
+	return splitMix(h ^ uint64(int64(y)))
+}
+
+func hashUnit(h uint64) float64 {
+	return float64(h>>11) / (1 << 53)
+}
+
+func smoothStep(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+// starDensity returns a star density multiplier for a point in world pixels,
+// bilinearly interpolated over a coarse lattice of hashed values.
+func starDensity(seed int64, wx, wy float64) float64 {
+	fx, fy := wx/starRegionSpan, wy/starRegionSpan
+	x0, y0 := math.Floor(fx), math.Floor(fy)
+	tx, ty := smoothStep(fx-x0), smoothStep(fy-y0)
+	ix, iy := int(x0), int(y0)
+
+	regionSeed := seed ^ 0x5EED
+	v00 := hashUnit(cellHash(regionSeed, ix, iy))
+	v10 := hashUnit(cellHash(regionSeed, ix+1, iy))
+	v01 := hashUnit(cellHash(regionSeed, ix, iy+1))
+	v11 := hashUnit(cellHash(regionSeed, ix+1, iy+1))
+
+	top := v00 + (v10-v00)*tx
+	bottom := v01 + (v11-v01)*tx
+	n := top + (bottom-top)*ty
+
+	return starDensityMin + (starDensityMax-starDensityMin)*n*n
+}
+
+func pickStarClass(rnd *rand.Rand) starClass {
+	r := rnd.Float64()
+	for _, c := range starClasses {
+		if r < c.weight {
+			return c
+		}
+		r -= c.weight
+	}
+
+	return starClasses[len(starClasses)-1]
+}
+
+func pickStarSize(rnd *rand.Rand, class starClass) int {
+	r := rnd.Float64()
+	for size, odds := range class.sizeOdds {
+		if r < odds {
+			return size
+		}
+		r -= odds
+	}
+
+	return 0
+}
+
+// lightenPixel keeps the brightest value per channel, so overlapping stars
+// never darken each other.
+func lightenPixel(img *image.RGBA, x, y int, c color.RGBA, bright float64) {
+	if !(image.Point{x, y}).In(img.Rect) {
+		return
+	}
+
+	old := img.RGBAAt(x, y)
+	n := color.RGBA{
+		uint8(float64(c.R) * bright),
+		uint8(float64(c.G) * bright),
+		uint8(float64(c.B) * bright),
+		uint8(255 * bright),
+	}
+	if old.R > n.R {
+		n.R = old.R
+	}
+	if old.G > n.G {
+		n.G = old.G
+	}
+	if old.B > n.B {
+		n.B = old.B
+	}
+	if old.A > n.A {
+		n.A = old.A
+	}
+
+	img.SetRGBA(x, y, n)
+}
+
+// skyRaster snaps the sky to the sprites palette, dithered at sprite pixel size
+var skyRaster = RasterOptions{
+	Dither:    DitherBayer,
+	Palette:   DB32Palette,
+	PixelSize: j0hnScale,
+}
+
+// paintSkyTile paints the w×h tile of grid cell: the atmosphere sky with its
+// stars on top. groundY is the row, counted from the top of cell (0, 0), that
+// sits at altitude 0. The result depends only on its arguments.
+func paintSkyTile(seed int64, cell image.Point, w, h int, groundY float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	altitudeAt := func(y int) float64 {
+		return (groundY - float64(cell.Y*h+y)) / pixelsPerKm
+	}
+
+	rasterizeRows(img, skyRaster, image.Point{cell.X * w, cell.Y * h}, func(y int) vec3.T {
+		return SkyColorAt(altitudeAt(y))
+	})
+	paintStars(img, seed, cell, func(y int) float64 {
+		return sim.StarDensityAt(altitudeAt(y))
+	})
+
+	return img
+}
+
+// paintStars scatters the stars of grid cell over img, zoneDensity scales the
+// density of each row between 0 and 1.
+func paintStars(img *image.RGBA, seed int64, cell image.Point, zoneDensity func(y int) float64) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	rnd := rand.New(rand.NewSource(int64(cellHash(seed, cell.X, cell.Y))))
+	originX, originY := float64(cell.X*w), float64(cell.Y*h)
+
+	for v := float64(w*h) * starsProportion * starDensityMax; v > 0; v-- {
+		x, y := rnd.Intn(w), rnd.Intn(h)
+		class := pickStarClass(rnd)
+		bright := class.minBright + rnd.Float64()*(class.maxBright-class.minBright)
+		size := pickStarSize(rnd, class)
+
+		// rejection sampling keeps density seamless across tile borders
+		density := starDensity(seed, originX+float64(x), originY+float64(y)) * zoneDensity(y)
+		if rnd.Float64()*starDensityMax > density {
+			continue
+		}
+
+		lightenPixel(img, x, y, class.tint, bright)
+		for arm := 1; arm <= size; arm++ {
+			fade := bright / float64(arm+1)
+			lightenPixel(img, x+arm, y, class.tint, fade)
+			lightenPixel(img, x-arm, y, class.tint, fade)
+			lightenPixel(img, x, y+arm, class.tint, fade)
+			lightenPixel(img, x, y-arm, class.tint, fade)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"image"
+	"runtime"
+)
+
+// tileQueueSize bounds how many sky tiles can wait for a worker at once.
+const tileQueueSize = 16
+
+type tileJob struct {
+	ctx  context.Context
+	cell image.Point
+}
+
+type tileResult struct {
+	cell   image.Point
+	pixels *image.RGBA
+}
+
+// TileGenerator paints sky tile pixels on worker goroutines, ahead of need.
+// Only the owner goroutine may call its methods; workers talk to it through
+// channels, and the GPU upload is left to the caller.
+type TileGenerator struct {
+	seed    int64
+	groundY float64
+	jobs    chan tileJob
+	results chan tileResult
+	pending map[image.Point]context.CancelFunc
+	ready   map[image.Point]*image.RGBA
+}
+
+// NewTileGenerator starts the workers, see paintSkyTile for groundY.
+func NewTileGenerator(seed int64, groundY float64) *TileGenerator {
+	workers := runtime.NumCPU() / 2
+	if workers < 1 {
+		workers = 1
+	}
+
+	gen := &TileGenerator{
+		seed:    seed,
+		groundY: groundY,
+		jobs:    make(chan tileJob, tileQueueSize),
+		results: make(chan tileResult, tileQueueSize+workers),
+		pending: make(map[image.Point]context.CancelFunc),
+		ready:   make(map[image.Point]*image.RGBA),
+	}
+
+	for i := 0; i < workers; i++ {
+		go gen.work()
+	}
+
+	return gen
+}
+
+func (gen *TileGenerator) work() {
+	for job := range gen.jobs {
+		if job.ctx.Err() != nil {
+			continue
+		}
+
+		pixels := paintSkyTile(gen.seed, job.cell, windowWidth, windowHeight, gen.groundY)
+
+		select {
+		case gen.results <- tileResult{cell: job.cell, pixels: pixels}:
+		case <-job.ctx.Done():
+		}
+	}
+}
+
+// Request queues a cell for generation. It returns false when the queue is
+// full, the caller is expected to ask again later.
+func (gen *TileGenerator) Request(cell image.Point) bool {
+	if _, ok := gen.ready[cell]; ok {
+		return true
+	}
+	if _, ok := gen.pending[cell]; ok {
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	select {
+	case gen.jobs <- tileJob{ctx: ctx, cell: cell}:
+		gen.pending[cell] = cancel
+		return true
+	default:
+		cancel()
+		return false
+	}
+}
+
+// Collect moves finished buffers into the ready set without blocking.
+func (gen *TileGenerator) Collect() {
+	for {
+		select {
+		case res := <-gen.results:
+			// results of cancelled jobs can still slip through, drop them
+			if cancel, ok := gen.pending[res.cell]; ok {
+				cancel()
+				delete(gen.pending, res.cell)
+				gen.ready[res.cell] = res.pixels
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Take hands over the pixels of a cell. When the workers haven't finished it
+// yet it is painted right away, so a needed tile is never missing.
+func (gen *TileGenerator) Take(cell image.Point) *image.RGBA {
+	if pixels, ok := gen.ready[cell]; ok {
+		delete(gen.ready, cell)
+		return pixels
+	}
+
+	gen.Cancel(cell)
+	backgroundLog.WithField("cell", cell).Debugln("tile not ready, painting it on the game thread")
+	return paintSkyTile(gen.seed, cell, windowWidth, windowHeight, gen.groundY)
+}
+
+// Cancel forgets a cell, whether it is still queued or already painted.
+func (gen *TileGenerator) Cancel(cell image.Point) {
+	if cancel, ok := gen.pending[cell]; ok {
+		cancel()
+		delete(gen.pending, cell)
+	}
+
+	delete(gen.ready, cell)
+}
+
+// Retain cancels every queued or painted cell for which keep returns false.
+func (gen *TileGenerator) Retain(keep func(image.Point) bool) {
+	for cell := range gen.pending {
+		if !keep(cell) {
+			gen.Cancel(cell)
+		}
+	}
+
+	for cell := range gen.ready {
+		if !keep(cell) {
+			delete(gen.ready, cell)
+		}
+	}
+}
+
+// Close cancels every job and stops the workers, the generator can't be used
+// afterwards.
+func (gen *TileGenerator) Close() {
+	gen.Retain(func(image.Point) bool { return false })
+	close(gen.jobs)
+}
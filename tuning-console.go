@@ -0,0 +1,17 @@
+package main
+
+import "0ms2/sim"
+
+// tuning is the game's, see the developer console
+var tuning = sim.DefaultTuning()
+
+func init() {
+	RegisterTuning("physics.airscale", "km over which the air thins by e", &tuning.AirScaleHeight)
+	RegisterTuning("physics.gravityscale", "velocity lost per tick for each m/s² of gravity", &tuning.GravityScale)
+	RegisterTuning("planet.spawn", "chance of a new planet every 100ms", &tuning.PlanetSpawn)
+	RegisterTuning("planet.speed", "top speed of new planets", &tuning.PlanetSpeed)
+	RegisterTuning("planet.influence", "how much J0hn's velocity moves planets", &tuning.PlanetInfluence)
+	RegisterTuning("powerup.spawn", "chance of a new powerup every 500ms", &tuning.PowerupSpawn)
+	RegisterTuning("powerup.speed", "top speed of new powerups", &tuning.PowerupSpeed)
+	RegisterTuning("powerup.influence", "how much J0hn's velocity moves powerups", &tuning.PowerupInfluence)
+}
@@ -1,18 +1,12 @@
 package main
 
 import (
-	"fmt"
-	"github.com/golang/freetype"
-	"github.com/golang/freetype/truetype"
+	"0ms2/sim"
 	"github.com/hajimehoshi/ebiten"
-	"github.com/hajimehoshi/ebiten/text"
-	log "github.com/sirupsen/logrus"
 	"github.com/ungerik/go3d/float64/vec2"
 	"golang.org/x/image/colornames"
 	"image"
 	"image/color"
-	"image/draw"
-	"io/ioutil"
 	"math"
 	"path/filepath"
 )
@@ -24,10 +18,27 @@ const fontfile = "ka1.ttf"
 
 const barW = 32
 
+// uiBarScale is the scale of the bar sprites on a windowWidth×windowHeight screen
+const uiBarScale = 3
+
 //const barH = 120
 const barMargin = 7
 const uiMarginLeft = 10
 
+// uiBarGap is the room, in design units, between the o2 and the fuel bar
+const uiBarGap = 30
+
+// zoneBannerTime is how long, in ms, the name of a new atmosphere zone stays up
+const zoneBannerTime = 3000
+const zoneBannerFade = 800
+
+// zoneBannerSettle is how long, in ms, J0hn must stay in a zone before it's
+// announced, so climbing through a few at once only shows the last one
+const zoneBannerSettle = 500
+
+// uiOutlineColor keeps HUD text readable over the bright lower sky
+var uiOutlineColor = color.RGBA{0x22, 0x20, 0x34, 0xFF}
+
 var imgBar *ebiten.Image
 var imgO2Level *ebiten.Image
 var imgFuelLevel *ebiten.Image
@@ -39,7 +50,7 @@ func init() {
 }
 
 type UserInterface struct {
-	player           *J0hn
+	player           *sim.J0hn
 	o2Position       vec2.T
 	fuelPosition     vec2.T
 	distancePosition vec2.T
@@ -49,52 +60,52 @@ type UserInterface struct {
 	fuelOffset       float64
 	distanceLevel    int
 	uiScale          float64
-	src              image.Image
-	font             *truetype.Font
-	ctxFont          *freetype.Context
+	zoneName         string
+	zoneTime         int64
+	bannerZone       string
+	bannerTimer      int64
+	layout           *HUDLayout
+	// players share the width of the screen, each gets their own bars
+	players int
 }
 
-func NewUi(player *J0hn) *UserInterface {
+func NewUi(player *sim.J0hn, layout *HUDLayout) *UserInterface {
 	ui := new(UserInterface)
-	ui.uiScale = 3
-	ui.o2Position = vec2.T{
-		uiMarginLeft,
-		windowHeight / ui.uiScale,
-	}
-	ui.fuelPosition = vec2.T{
-		uiMarginLeft + (barW * ui.uiScale),
-		windowHeight / ui.uiScale,
-	}
+	ui.layout = layout
+	ui.players = 1
+	ui.place()
 	ui.player = player
-	ui.src = image.NewUniform(colornames.Green)
-	fontBytes, err := ioutil.ReadFile(fontfile)
-	if err != nil {
-		log.Println(err)
-	}
-
-	f, err := freetype.ParseFont(fontBytes)
-	if err != nil {
-		log.Println(err)
-	}
-	ui.font = f
 
-	imgClip := image.NewRGBA(image.Rect(0, 0, 500, 200))
-	draw.Draw(imgClip, imgClip.Bounds(), image.NewUniform(colornames.Green), image.Point{}, draw.Src)
-
-	ctxFont := freetype.NewContext()
-	ctxFont.SetDPI(72)
-	ctxFont.SetFontSize(20)
-	ctxFont.SetClip(imgClip.Bounds())
-	ctxFont.SetSrc(imgClip)
-	ctxFont.SetFont(ui.font)
-	ui.ctxFont = ctxFont
+	return ui
+}
 
+// SetPlayers makes room for the bars of the other players, labelled with
+// the player number when there are more than one.
+func (ui *UserInterface) SetPlayers(players int) *UserInterface {
+	ui.players = players
+	ui.place()
 	return ui
 }
 
+// place lays the widgets out for the current screen size.
+func (ui *UserInterface) place() {
+	ui.uiScale = ui.layout.PixelScale(uiBarScale)
+	w, h := imgBar.Size()
+	size := vec2.T{float64(w) * ui.uiScale, float64(h) * ui.uiScale}
+
+	// every player gets an equal share of the design width inside the safe area
+	x := 0.0
+	if ui.player != nil {
+		share := (windowWidth - ui.layout.safeArea.Left - ui.layout.safeArea.Right) / float64(ui.players)
+		x = float64(ui.player.Index) * share
+	}
+	ui.o2Position = ui.layout.Place(AnchorBottomLeft, vec2.T{x, 30}, size)
+	ui.fuelPosition = ui.layout.Place(AnchorBottomLeft, vec2.T{x + float64(w*uiBarScale) + uiBarGap, 30}, size)
+	ui.distancePosition = ui.layout.Place(AnchorBottomLeft, vec2.T{x + uiMarginLeft, 0}, vec2.T{})
+}
+
 func (ui *UserInterface) Draw(screen *ebiten.Image) {
 	//if !ui.player.isLifting && ui.player.flying {}
-	ui.ctxFont.SetDst(screen)
 	optO2 := &ebiten.DrawImageOptions{}
 	optO2.GeoM.Translate(ui.o2Position[0]/ui.uiScale, ui.o2Position[1]/ui.uiScale)
 	optO2.GeoM.Scale(ui.uiScale, ui.uiScale)
@@ -115,49 +126,87 @@ func (ui *UserInterface) Draw(screen *ebiten.Image) {
 	_ = screen.DrawImage(imgFuelLevel.SubImage(image.Rect(0, 0, barW, ui.fuelLevel)).(*ebiten.Image), optFuelFill)
 	_ = screen.DrawImage(imgBar, optFuel)
 
-	text.Draw(screen, fmt.Sprintf("%vkm", math.Round(ui.player.relativePosition[1])), truetype.NewFace(ui.font, &truetype.Options{
-		Size:              30,
-		DPI:               72,
-		Hinting:           0,
-		GlyphCacheEntries: 0,
-		SubPixelsX:        0,
-		SubPixelsY:        0,
-	}), uiMarginLeft*2, windowHeight-10, colornames.Green)
-
-	text.Draw(screen, "O2", truetype.NewFace(ui.font, &truetype.Options{
-		Size:              20,
-		DPI:               72,
-		Hinting:           0,
-		GlyphCacheEntries: 0,
-		SubPixelsX:        0,
-		SubPixelsY:        0,
-	}), int(ui.o2Position[0])+15,
-		int(ui.o2Position[1])-4,
-		color.RGBA{0x5b, 0x6E, 0xE1, 0xFF},
+	scale := ui.layout.Scale() * settings.TextScale
+	outline := TextStyle{
+		Outline:      int(math.Max(1, math.Round(scale))),
+		OutlineColor: uiOutlineColor,
+	}
+
+	distanceStyle := outline
+	distanceStyle.Color = colornames.Green
+	distanceSize := 30.0
+	if ui.players > 1 {
+		distanceSize = 18
+
+		playerStyle := outline
+		playerStyle.Color = playerColors[ui.player.Index]
+		DrawText(screen, T("hud.player", ui.player.Index+1), fonts.Face(uiFont, 20*scale),
+			int(ui.o2Position[0]+15*scale),
+			int(ui.o2Position[1]-28*scale),
+			playerStyle,
+		)
+	}
+	DrawText(screen, FormatDistance(ui.player.RelativePosition[1]), fonts.Face(uiFont, distanceSize*scale),
+		int(ui.distancePosition[0]), int(ui.distancePosition[1]), distanceStyle)
+
+	o2Style := outline
+	o2Style.Color = color.RGBA{0x5b, 0x6E, 0xE1, 0xFF}
+	DrawText(screen, T("hud.o2"), fonts.Face(uiFont, 20*scale),
+		int(ui.o2Position[0]+15*scale),
+		int(ui.o2Position[1]-4*scale),
+		o2Style,
 	)
 
-	text.Draw(screen, "Fuel", truetype.NewFace(ui.font, &truetype.Options{
-		Size:              20,
-		DPI:               72,
-		Hinting:           0,
-		GlyphCacheEntries: 0,
-		SubPixelsX:        0,
-		SubPixelsY:        0,
-	}), int(ui.fuelPosition[0]),
-		int(ui.fuelPosition[1])-4,
-		color.RGBA{0xac, 0x32, 0x32, 0xFF},
+	fuelStyle := outline
+	fuelStyle.Color = color.RGBA{0xac, 0x32, 0x32, 0xFF}
+	DrawText(screen, T("hud.fuel"), fonts.Face(uiFont, 20*scale),
+		int(ui.fuelPosition[0]),
+		int(ui.fuelPosition[1]-4*scale),
+		fuelStyle,
 	)
+
+	// the first player announces the zones for everyone
+	if ui.bannerTimer > 0 && ui.player.Index == 0 {
+		alpha := math.Min(1, float64(ui.bannerTimer)/zoneBannerFade)
+		pos := ui.layout.Place(AnchorTopCenter, vec2.T{0, 140}, vec2.T{})
+		DrawText(screen, T(zoneMessageKey(ui.bannerZone)), fonts.Face(uiFont, 28*scale), int(pos[0]), int(pos[1]), TextStyle{
+			Color:       color.NRGBA{0xcb, 0xdb, 0xfc, uint8(0xFF * alpha)},
+			Align:       AlignCenter,
+			Shadow:      image.Point{int(math.Round(2 * scale)), int(math.Round(2 * scale))},
+			ShadowColor: color.NRGBA{0x22, 0x20, 0x34, uint8(0xC0 * alpha)},
+		})
+	}
 }
 
 func (ui *UserInterface) Update(screen *ebiten.Image, delta int64) {
+	ui.place()
+
 	_, h := imgO2Level.Size()
-	ui.o2Level = int(float64(h-14) * ui.player.o2 / 100)
+	ui.o2Level = int(float64(h-14) * ui.player.O2 / 100)
 	ui.o2Level += barMargin
 	ui.o2Offset = float64(h-ui.o2Level) * ui.uiScale
 	ui.o2Offset -= barMargin * ui.uiScale
 
-	ui.fuelLevel = int(float64(h-14) * ui.player.fuel / 100)
+	ui.fuelLevel = int(float64(h-14) * ui.player.Fuel / 100)
 	ui.fuelLevel += barMargin
 	ui.fuelOffset = float64(h-ui.fuelLevel) * ui.uiScale
 	ui.fuelOffset -= barMargin * ui.uiScale
+
+	// announce every atmosphere zone J0hn settles in but the one we start in
+	zone, _, _ := sim.AtmosphereAt(ui.player.RelativePosition[1])
+	if zone.Name != ui.zoneName {
+		ui.zoneName = zone.Name
+		ui.zoneTime = 0
+	} else {
+		ui.zoneTime += delta
+	}
+
+	if ui.bannerZone == "" {
+		ui.bannerZone = zone.Name
+	} else if ui.bannerZone != ui.zoneName && ui.zoneTime >= zoneBannerSettle {
+		ui.bannerZone = ui.zoneName
+		ui.bannerTimer = zoneBannerTime
+	} else if ui.bannerTimer > 0 {
+		ui.bannerTimer -= delta
+	}
 }
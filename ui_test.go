@@ -0,0 +1,24 @@
+package main
+
+import (
+	"0ms2/sim"
+	"image"
+	"testing"
+)
+
+func TestCoopHUDInsideScreen(t *testing.T) {
+	w, _ := imgBar.Size()
+	for _, screen := range []image.Point{{windowWidth, windowHeight}, {1280, 720}, {1000, 750}, {640, 480}} {
+		layout := NewHUDLayout(screen)
+		for i := 0; i < sim.MaxPlayers; i++ {
+			ui := NewUi(sim.NewJ0hn().SetPlayer(i), layout).SetPlayers(sim.MaxPlayers)
+			width := float64(w) * ui.uiScale
+			for name, bar := range map[string]float64{"o2": ui.o2Position[0], "fuel": ui.fuelPosition[0]} {
+				if bar < 0 || bar+width > float64(screen.X) {
+					t.Errorf("%v screen: %s bar of player %d from %v to %v is off the screen",
+						screen, name, i+1, bar, bar+width)
+				}
+			}
+		}
+	}
+}